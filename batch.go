@@ -0,0 +1,145 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// BatchError is the error of one row of an array DML.
+type BatchError struct {
+	// Row is the index of the failed row in the bound slices.
+	Row int
+	Err *Error
+}
+
+func (be BatchError) Error() string {
+	return fmt.Sprintf("row %d: %v", be.Row, be.Err)
+}
+
+// BatchErrors is returned by ExecuteMany when some rows have failed.
+type BatchErrors []BatchError
+
+func (be BatchErrors) Error() string {
+	texts := make([]string, len(be))
+	for i, e := range be {
+		texts[i] = e.Error()
+	}
+	return fmt.Sprintf("%d rows failed: %s", len(be), strings.Join(texts, "; "))
+}
+
+// ExecuteMany executes the DML statement with the columns bound as arrays.
+// Each column must be a slice of a type BindName accepts as an array bind,
+// and all of them must have the same length.
+//
+// The rows are sent in chunks of BatchSize rows.
+// The failed rows are returned as BatchErrors, the other rows are executed.
+// An error failing a whole chunk stops the execution, and is returned
+// joined with the BatchErrors of the chunks before.
+// The returned number is the number of all affected rows.
+func (stmt *Statement) ExecuteMany(qry string, columns ...interface{}) (int64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if qry == "" {
+		qry = stmt.statement
+	}
+	if qry == "" {
+		return 0, ErrEmptyStatement
+	}
+	n := -1
+	cols := make([]reflect.Value, len(columns))
+	for i, c := range columns {
+		cols[i] = reflect.ValueOf(c)
+		if cols[i].Kind() != reflect.Slice {
+			return 0, fmt.Errorf("ExecuteMany: column %d is not a slice, but %T", i+1, c)
+		}
+		if n < 0 {
+			n = cols[i].Len()
+		} else if cols[i].Len() != n {
+			return 0, fmt.Errorf("ExecuteMany: column %d has %d rows, wanted %d", i+1, cols[i].Len(), n)
+		}
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	chunk := int(stmt.BatchSize)
+	if chunk <= 0 {
+		chunk = int(BindArraySize)
+	}
+
+	var (
+		affected  int64
+		batchErrs BatchErrors
+	)
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		if err := stmt.Prepare(qry); err != nil {
+			return affected, err
+		}
+		if C.OCI_BindArraySetSize(stmt.handle, C.uint(end-start)) != C.TRUE {
+			return affected, getLastErr()
+		}
+		for i, c := range cols {
+			part := c.Slice(start, end).Interface()
+			stmt.keep = append(stmt.keep, part)
+			if err := stmt.BindPos(i+1, part); err != nil {
+				return affected, err
+			}
+		}
+		if C.OCI_Execute(stmt.handle) != C.TRUE {
+			errCount := int(C.OCI_GetBatchErrorCount(stmt.handle))
+			if errCount == 0 {
+				err := getLastErr()
+				// OCILIB collects the batch errors only for more than one row
+				if oraErr, ok := err.(*Error); ok && end-start == 1 {
+					batchErrs = append(batchErrs, BatchError{Row: start, Err: oraErr})
+					continue
+				}
+				if len(batchErrs) > 0 {
+					return affected, errors.Join(batchErrs, err)
+				}
+				return affected, err
+			}
+			for i := 0; i < errCount; i++ {
+				ociErr := C.OCI_GetBatchError(stmt.handle)
+				if ociErr == nil {
+					break
+				}
+				batchErrs = append(batchErrs, BatchError{
+					// OCILIB's row indexes start at 1
+					Row: start + int(C.OCI_ErrorGetRow(ociErr)) - 1,
+					Err: ociErrToErr(ociErr),
+				})
+			}
+		}
+		affected += int64(C.OCI_GetAffectedRows(stmt.handle))
+	}
+	if len(batchErrs) > 0 {
+		return affected, batchErrs
+	}
+	return affected, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExecuteMany(t *testing.T) {
+	cx, st := testStatement(t)
+	testObject(t, st, "CREATE TABLE tst_gocilib_batch (id NUMBER(3) PRIMARY KEY, name VARCHAR2(10))",
+		"DROP TABLE tst_gocilib_batch")
+
+	// in chunks of two rows: a duplicate and a too big id in the second chunk,
+	// and a too big id alone in the third one
+	st.BatchSize = 2
+	n, err := st.ExecuteMany("INSERT INTO tst_gocilib_batch (id, name) VALUES (:1, :2)",
+		[]int64{1, 2, 2, 1000, 1001}, []string{"a", "b", "c", "d", "e"})
+	var be BatchErrors
+	if !errors.As(err, &be) {
+		t.Fatalf("wanted BatchErrors, got %v", err)
+	}
+	if len(be) != 3 || be[0].Row != 2 || be[0].Err.Code != 1 || be[1].Row != 3 || be[1].Err.Code != 1438 ||
+		be[2].Row != 4 || be[2].Err.Code != 1438 {
+		t.Errorf("wanted ORA-00001 for row 2 and ORA-01438 for rows 3 and 4, got %v", be)
+	}
+	if n != 2 {
+		t.Errorf("got %d affected rows, wanted 2", n)
+	}
+	if row := queryRow(t, cx, "SELECT COUNT(0) FROM tst_gocilib_batch"); row[0] != int64(2) {
+		t.Errorf("got %v rows, wanted 2", row[0])
+	}
+}
@@ -16,35 +16,56 @@ limitations under the License.
 
 package gocilib
 
-// #cgo LDFLAGS: -locilib
 // #include "ocilib.h"
-//
-// const int sof_OCI_DateP = sizeof(OCI_Date*);
-// const int sof_OCI_IntervalP = sizeof(OCI_Interval*);
 import "C"
 
 import (
 	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"runtime"
 	"strconv"
 	"time"
 	"unsafe"
-
-	"gopkg.in/inconshreveable/log15.v2"
 )
 
 func (stmt *Statement) BindPos(pos int, arg driver.Value) error {
 	return stmt.BindName(":"+strconv.Itoa(pos), arg)
 }
 
+// BindName binds the value to the named placeholder.
+//
+// In queries, the number and string slices are bound as SYS.ODCINUMBERLIST
+// and SYS.ODCIVARCHAR2LIST collections, to be used as TABLE(:ids);
+// in the other statements, slices are array binds: wrap them with List
+// to bind them as collections there, too.
+// For the PL/SQL associative array parameters, use PLSQLArray.
+//
+// A time.Time is bound as TimeAuto: as TIMESTAMP WITH TIME ZONE if its location
+// is not time.Local (UTC included), as TIMESTAMP otherwise, with nanoseconds
+// (it used to be bound as DATE, dropping the fractional seconds and the zone).
+// Comparing a DATE column to such a bind converts the column, and prevents
+// using its indexes: bind TimeAs{Time: t, Type: TimeDate} there.
 func (stmt *Statement) BindName(name string, value driver.Value) error {
+	err := stmt.bindName(name, value)
+	stmt.trace(TraceEvent{Kind: TraceBind, BindName: name, BindValue: value, Err: err})
+	return err
+}
+
+func (stmt *Statement) bindName(name string, value driver.Value) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if l, ok := value.(ListValue); ok {
+		typeName := selectListType(l.values)
+		if typeName == "" {
+			return fmt.Errorf("BindName(%s): cannot bind %T as a list", name, l.values)
+		}
+		return stmt.bindSlice(name, typeName, l.values)
+	}
+	if typeName := selectListType(value); typeName != "" && C.OCI_GetStatementType(stmt.handle) == C.OCI_CST_SELECT {
+		return stmt.bindSlice(name, typeName, value)
+	}
 	h, nm, ok := stmt.handle, C.CString(name), C.int(C.FALSE)
-	Log.Debug("BindName", "name", name,
-		"type", log15.Lazy{func() string { return fmt.Sprintf("%T", value) }},
-		"value", log15.Lazy{func() string { return fmt.Sprintf("%#v", value) }},
-	)
-Outer:
 	switch x := value.(type) {
 	case int16: // short
 		ok = C.OCI_BindShort(h, nm, (*C.short)(unsafe.Pointer(&x)))
@@ -61,7 +82,13 @@ Outer:
 	case int: // int
 		ok = C.OCI_BindInt(h, nm, (*C.int)(unsafe.Pointer(&x)))
 	case []int:
-		ok = C.OCI_BindArrayOfInts(h, nm, (*C.int)(unsafe.Pointer(&x[0])), C.uint(len(x)))
+		// Go's int may be wider than C's int
+		y := make([]int64, len(x))
+		for i, v := range x {
+			y[i] = int64(v)
+		}
+		stmt.keep = append(stmt.keep, y)
+		ok = C.OCI_BindArrayOfBigInts(h, nm, (*C.big_int)(unsafe.Pointer(&y[0])), C.uint(len(y)))
 	case uint: // int
 		ok = C.OCI_BindUnsignedInt(h, nm, (*C.uint)(unsafe.Pointer(&x)))
 	case *uint: // int
@@ -91,6 +118,27 @@ Outer:
 		}
 		y[m] = 0 // trailing 0
 		ok = C.OCI_BindString(h, nm, (*C.dtext)(unsafe.Pointer(&y[0])), C.uint(len(x)))
+	case Number:
+		// integers are bound as such, the others as OCINumber, as the server would
+		// convert a text with its NLS_NUMERIC_CHARACTERS
+		if x != "" {
+			if i, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+				return stmt.bindName(name, i)
+			}
+			free, err := bindNumber(C.OCI_HandleGetStatement(h),
+				C.OCI_HandleGetError(C.OCI_StatementGetConnection(h)), name, x)
+			if err != nil {
+				return fmt.Errorf("BindName(%s): %v", name, err)
+			}
+			stmt.frees = append(stmt.frees, free)
+			return nil
+		}
+		y := make([]byte, 2)
+		stmt.keep = append(stmt.keep, y)
+		ok = C.OCI_BindString(h, nm, (*C.dtext)(unsafe.Pointer(&y[0])), 1)
+		if ok == C.TRUE {
+			ok = C.OCI_BindSetNull(C.OCI_GetBind2(h, nm))
+		}
 	case StringVar:
 		ok = C.OCI_BindString(h, nm, (*C.dtext)(unsafe.Pointer(&x.data[0])), C.uint(len(x.data)))
 	case *StringVar:
@@ -112,10 +160,11 @@ Outer:
 		if m == 0 {
 			m = 32767
 		}
-		y := make([]byte, m*len(x))
+		y := make([]byte, (m+1)*len(x))
 		for i, s := range x {
-			copy(y[i*m:(i+1)*m], []byte(s))
+			copy(y[i*(m+1):i*(m+1)+m], []byte(s))
 		}
+		stmt.keep = append(stmt.keep, y)
 		ok = C.OCI_BindArrayOfStrings(h, nm, (*C.dtext)(unsafe.Pointer(&y[0])), C.uint(m), C.uint(len(x)))
 	case []byte:
 		ok = C.OCI_BindRaw(h, nm, unsafe.Pointer(&x[0]), C.uint(cap(x)))
@@ -138,6 +187,7 @@ Outer:
 		for i, b := range x {
 			copy(y[i*m:(i+1)*m], b)
 		}
+		stmt.keep = append(stmt.keep, y)
 		ok = C.OCI_BindArrayOfRaws(h, nm, unsafe.Pointer(&y[0]), C.uint(m), C.uint(len(x)))
 	case float32:
 		ok = C.OCI_BindFloat(h, nm, (*C.float)(&x))
@@ -152,52 +202,26 @@ Outer:
 	case []float64:
 		ok = C.OCI_BindArrayOfDoubles(h, nm, (*C.double)(&x[0]), C.uint(len(x)))
 	case time.Time:
-		od := C.OCI_DateCreate(C.OCI_StatementGetConnection(stmt.handle))
-		y, m, d := x.Date()
-		H, M, S := x.Clock()
-		if C.OCI_DateSetDateTime(od, C.int(y), C.int(m), C.int(d), C.int(H), C.int(M), C.int(S)) != C.TRUE {
-			break
-		}
-		ok = C.OCI_BindDate(h, nm, od)
+		return stmt.bindTime(name, TimeAs{Time: x})
+	case TimeAs:
+		return stmt.bindTime(name, x)
 	case []time.Time:
-		od := C.OCI_DateArrayCreate(C.OCI_StatementGetConnection(stmt.handle), C.uint(len(x)))
-		sof_OCI_DateP := C.int(C.sof_OCI_DateP)
-		for i, t := range x {
-			y, m, d := t.Date()
-			H, M, S := t.Clock()
-			if C.OCI_DateSetDateTime(
-				(*C.OCI_Date)(unsafe.Pointer(
-					uintptr(unsafe.Pointer(od))+uintptr(sof_OCI_DateP*C.int(i))),
-				),
-				C.int(y), C.int(m), C.int(d), C.int(H), C.int(M), C.int(S),
-			) != C.TRUE {
-				break Outer
-			}
-		}
-		ok = C.OCI_BindArrayOfDates(h, nm, od, C.uint(len(x)))
-	case time.Duration:
-		oi := C.OCI_IntervalCreate(C.OCI_StatementGetConnection(stmt.handle), C.OCI_INTERVAL_DS)
-		d, H, M, S, ms := durationAsDays(x)
-		if C.OCI_IntervalSetDaySecond(oi, C.int(d), C.int(H), C.int(M), C.int(S), C.int(ms/100)) != C.TRUE {
-			break
-		}
-		ok = C.OCI_BindInterval(h, nm, oi)
+		return stmt.bindTimes(name, x)
+	case time.Duration, YearMonthInterval, DaySecondInterval:
+		return stmt.bindInterval(name, x)
 	case []time.Duration:
-		oi := C.OCI_IntervalArrayCreate(C.OCI_StatementGetConnection(stmt.handle), C.OCI_INTERVAL_DS, C.uint(len(x)))
-		sof_OCI_IntervalP := C.int(C.sof_OCI_IntervalP)
-		for i, t := range x {
-			d, H, M, S, ms := durationAsDays(t)
-			if C.OCI_IntervalSetDaySecond(
-				(*C.OCI_Interval)(unsafe.Pointer(
-					uintptr(unsafe.Pointer(oi))+uintptr(sof_OCI_IntervalP*C.int(i)))),
-				C.int(d), C.int(H), C.int(M), C.int(S), C.int(ms/100),
-			) != C.TRUE {
-				break Outer
-			}
-		}
-		ok = C.OCI_BindArrayOfIntervals(h, nm, oi, C.OCI_INTERVAL_DS, C.uint(len(x)))
+		return stmt.bindIntervals(name, len(x), func(i int) interface{} { return x[i] })
+	case []YearMonthInterval:
+		return stmt.bindIntervals(name, len(x), func(i int) interface{} { return x[i] })
+	case []DaySecondInterval:
+		return stmt.bindIntervals(name, len(x), func(i int) interface{} { return x[i] })
 	case LOB:
 		ok = C.OCI_BindLob(h, nm, x.handle)
+	case *LOB:
+		if err := x.Flush(); err != nil {
+			return fmt.Errorf("BindName(%s): %v", name, err)
+		}
+		ok = C.OCI_BindLob(h, nm, x.handle)
 	case []LOB:
 		if len(x) > 0 {
 			lo := make([]*C.OCI_Lob, len(x))
@@ -218,6 +242,8 @@ Outer:
 		}
 	case Object:
 		ok = C.OCI_BindObject(h, nm, x.handle)
+	case *Object:
+		ok = C.OCI_BindObject(h, nm, x.handle)
 	case []Object:
 		if len(x) > 0 {
 			ob := make([]*C.OCI_Object, len(x))
@@ -228,6 +254,8 @@ Outer:
 		}
 	case Coll:
 		ok = C.OCI_BindColl(h, nm, x.handle)
+	case *Coll:
+		ok = C.OCI_BindColl(h, nm, x.handle)
 	case []Coll:
 		if len(x) > 0 {
 			co := make([]*C.OCI_Coll, len(x))
@@ -238,6 +266,8 @@ Outer:
 		}
 	case Ref:
 		ok = C.OCI_BindRef(h, nm, x.handle)
+	case *Ref:
+		ok = C.OCI_BindRef(h, nm, x.handle)
 	case []Ref:
 		if len(x) > 0 {
 			re := make([]*C.OCI_Ref, len(x))
@@ -250,10 +280,23 @@ Outer:
 		ok = C.OCI_BindStatement(h, nm, x.handle)
 	case Long:
 		ok = C.OCI_BindLong(h, nm, x.handle, x.Len())
+	case Out:
+		return stmt.bindOut(name, x)
+	case *Out:
+		return stmt.bindOut(name, *x)
+	case PLSQLArray:
+		return stmt.bindPLSQLArray(name, x)
+	case *PLSQLArray:
+		return stmt.bindPLSQLArray(name, *x)
+	case ObjectTypeNamer:
+		if t := reflect.TypeOf(x); t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+			return stmt.bindSlice(name, x.ObjectTypeName(), x)
+		}
+		return stmt.bindStruct(name, x)
 	default:
 		v := reflect.ValueOf(value)
 		if v.Kind() == reflect.Ptr {
-			return stmt.BindName(name, v.Elem().Interface())
+			return stmt.bindName(name, v.Elem().Interface())
 		}
 		return fmt.Errorf("BindName(%s): unknown type %T", name, value)
 	}
@@ -262,17 +305,3 @@ Outer:
 	}
 	return nil
 }
-
-func durationAsDays(d time.Duration) (days, hours, minutes, seconds, milliseconds int) {
-	ns := d.Nanoseconds()
-	days = int(ns / int64(time.Hour) / 24)
-	ns -= int64(days) * int64(time.Hour) * 240
-	hours = int(ns / int64(time.Hour))
-	ns -= int64(hours) * int64(time.Hour)
-	minutes = int(ns / int64(time.Minute))
-	ns -= int64(minutes) * int64(time.Minute)
-	seconds = int(ns / int64(time.Second))
-	ns -= int64(seconds) * int64(time.Second)
-	milliseconds = int(ns / int64(time.Millisecond))
-	return
-}
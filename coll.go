@@ -0,0 +1,539 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// Coll is a collection: a VARRAY or a nested table.
+//
+// A Coll fetched by FetchInto is valid only till the next fetch;
+// the Colls created with NewColl must be closed after use.
+type Coll struct {
+	handle *C.OCI_Coll
+	conn   *Connection
+	typ    *ObjectType
+	owned  bool // created by NewColl, freed by Close
+
+	// numberMode is the NumberMode of the statement which has fetched the collection.
+	numberMode NumberMode
+}
+
+// NewColl creates a new, empty collection of the named type
+// (such as "SYS.ODCINUMBERLIST").
+func (conn *Connection) NewColl(typeName string) (*Coll, error) {
+	typ, err := conn.ObjectType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.newColl(typ)
+}
+
+func (conn *Connection) newColl(typ *ObjectType) (*Coll, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	co := Coll{handle: C.OCI_CollCreate(typ.handle), conn: conn, typ: typ, owned: true}
+	if co.handle == nil {
+		return nil, getLastErr()
+	}
+	return &co, nil
+}
+
+// newFetchedColl returns the collection got from OCILIB, not to be freed.
+func (conn *Connection) newFetchedColl(handle *C.OCI_Coll) *Coll {
+	return &Coll{handle: handle, conn: conn}
+}
+
+func (co Coll) Type() *C.OCI_TypeInfo {
+	return C.OCI_CollGetTypeInfo(co.handle)
+}
+
+// ObjectType returns the type of the collection.
+func (co *Coll) ObjectType() *ObjectType {
+	if co.typ == nil {
+		co.typ = co.conn.objectType(co.Type())
+	}
+	return co.typ
+}
+
+// elemType returns the description of the elements.
+func (co *Coll) elemType() ObjectAttribute {
+	if typ := co.ObjectType(); len(typ.Attributes) > 0 {
+		return typ.Attributes[0]
+	}
+	return ObjectAttribute{}
+}
+
+// Close frees the collection, if it has been created by NewColl.
+func (co *Coll) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if co == nil || co.handle == nil {
+		return nil
+	}
+	var err error
+	if co.owned && C.OCI_CollFree(co.handle) != C.TRUE {
+		err = getLastErr()
+	}
+	co.handle = nil
+	return err
+}
+
+// Len returns the number of elements.
+func (co *Coll) Len() int {
+	return int(C.OCI_CollGetSize(co.handle))
+}
+
+// Clear removes all the elements.
+func (co *Coll) Clear() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_CollClear(co.handle) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Trim removes the last n elements.
+func (co *Coll) Trim(n int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_CollTrim(co.handle, C.uint(n)) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Get returns the i-th (from 0) element, with the types of Object.Get.
+//
+// The returned *LOB, *Object, *Ref and *Coll are valid only till the next Get.
+func (co *Coll) Get(i int) (interface{}, error) {
+	return co.get(i, co.numberMode)
+}
+
+// get is Get, returning the NUMBER elements as mode says.
+func (co *Coll) get(i int, mode NumberMode) (interface{}, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if i < 0 || i >= co.Len() {
+		return nil, fmt.Errorf("Get(%d): index out of range [0, %d)", i, co.Len())
+	}
+	elem := C.OCI_CollGetAt(co.handle, C.uint(i+1))
+	if elem == nil {
+		return nil, fmt.Errorf("Get(%d): %v", i, getLastErr())
+	}
+	v, err := co.getElem(elem, mode)
+	if err != nil {
+		return nil, fmt.Errorf("Get(%d): %v", i, err)
+	}
+	return v, nil
+}
+
+func (co *Coll) getElem(elem *C.OCI_Elem, mode NumberMode) (interface{}, error) {
+	if C.OCI_ElemIsNull(elem) == C.TRUE {
+		return nil, nil
+	}
+	a := co.elemType()
+	switch a.Type {
+	case ColNumeric:
+		n, err := getElemNumber(elem)
+		if err != nil {
+			return nil, err
+		}
+		return a.number(n, mode)
+	case ColText:
+		return C.GoString(C.OCI_ElemGetString(elem)), nil
+	case ColRaw:
+		b := make([]byte, a.Size)
+		if len(b) == 0 {
+			return b, nil
+		}
+		n := C.OCI_ElemGetRaw(elem, unsafe.Pointer(&b[0]), C.uint(len(b)))
+		return b[:n], nil
+	case ColDate:
+		if od := C.OCI_ElemGetDate(elem); od != nil {
+			return ociDateToTime(od)
+		}
+	case ColTimestamp:
+		if ts := C.OCI_ElemGetTimestamp(elem); ts != nil {
+			return ociTimestampToTime(ts)
+		}
+	case ColInterval:
+		if oi := C.OCI_ElemGetInterval(elem); oi != nil {
+			return ociIntervalValue(oi)
+		}
+	case ColLob:
+		if lob := C.OCI_ElemGetLob(elem); lob != nil {
+			return &LOB{handle: lob}, nil
+		}
+	case ColObject:
+		if o := C.OCI_ElemGetObject(elem); o != nil {
+			return &Object{handle: o, conn: co.conn, typ: a.ObjectType, numberMode: co.numberMode}, nil
+		}
+	case ColRef:
+		if r := C.OCI_ElemGetRef(elem); r != nil {
+			return &Ref{handle: r, conn: co.conn}, nil
+		}
+	case ColCollection:
+		if c := C.OCI_ElemGetColl(elem); c != nil {
+			return &Coll{handle: c, conn: co.conn, typ: a.ObjectType, numberMode: co.numberMode}, nil
+		}
+	case ColFile:
+		if fi := C.OCI_ElemGetFile(elem); fi != nil {
+			return File{handle: fi}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported element type %s", a.Type)
+	}
+	return nil, getLastErr()
+}
+
+// Set sets the i-th (from 0) element to value, with the types of Object.Set.
+func (co *Coll) Set(i int, value interface{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if i < 0 || i >= co.Len() {
+		return fmt.Errorf("Set(%d): index out of range [0, %d)", i, co.Len())
+	}
+	elem, err := co.newElem(value)
+	if err != nil {
+		return fmt.Errorf("Set(%d): %v", i, err)
+	}
+	defer C.OCI_ElemFree(elem)
+	if C.OCI_CollSetAt(co.handle, C.uint(i+1), elem) != C.TRUE {
+		return fmt.Errorf("Set(%d): %v", i, getLastErr())
+	}
+	return nil
+}
+
+// Append appends value to the end of the collection,
+// with the types of Object.Set.
+func (co *Coll) Append(value interface{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	elem, err := co.newElem(value)
+	if err != nil {
+		return fmt.Errorf("Append: %v", err)
+	}
+	defer C.OCI_ElemFree(elem)
+	if C.OCI_CollAppend(co.handle, elem) != C.TRUE {
+		return fmt.Errorf("Append: %v", getLastErr())
+	}
+	return nil
+}
+
+// newElem returns a new element set to value. It must be freed with OCI_ElemFree.
+func (co *Coll) newElem(value interface{}) (*C.OCI_Elem, error) {
+	elem := C.OCI_ElemCreate(co.ObjectType().handle)
+	if elem == nil {
+		return nil, getLastErr()
+	}
+	if err := co.setElem(elem, value); err != nil {
+		C.OCI_ElemFree(elem)
+		return nil, err
+	}
+	return elem, nil
+}
+
+func (co *Coll) setElem(elem *C.OCI_Elem, value interface{}) error {
+	a := co.elemType()
+	if v, ok := value.(driver.Valuer); ok && value != nil {
+		if _, isObj := value.(ObjectTypeNamer); !isObj {
+			var err error
+			if value, err = v.Value(); err != nil {
+				return err
+			}
+		}
+	}
+	if value == nil {
+		if C.OCI_ElemSetNull(elem) != C.TRUE {
+			return getLastErr()
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr && rv.Type() != lobPtrType && rv.Type() != objectPtrType &&
+		rv.Type() != refPtrType && rv.Type() != collPtrType {
+		if rv.IsNil() {
+			return co.setElem(elem, nil)
+		}
+		return co.setElem(elem, rv.Elem().Interface())
+	}
+	ok := C.int(C.FALSE)
+	switch a.Type {
+	case ColNumeric:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ok = C.OCI_ElemSetBigInt(elem, C.big_int(rv.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ok = C.OCI_ElemSetUnsignedBigInt(elem, C.big_uint(rv.Uint()))
+		case reflect.Float32, reflect.Float64:
+			ok = C.OCI_ElemSetDouble(elem, C.double(rv.Float()))
+		default:
+			n, err := exactNumber(value)
+			if err != nil {
+				return err
+			}
+			if n == "" {
+				return fmt.Errorf("cannot set %T as %s", value, a.Type)
+			}
+			return setElemNumber(elem, n)
+		}
+	case ColText:
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+		s := C.CString(rv.String())
+		defer C.free(unsafe.Pointer(s))
+		ok = C.OCI_ElemSetString(elem, (*C.dtext)(unsafe.Pointer(s)))
+	case ColRaw:
+		b, isBytes := value.([]byte)
+		if !isBytes {
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+		if len(b) == 0 {
+			return co.setElem(elem, nil)
+		}
+		ok = C.OCI_ElemSetRaw(elem, unsafe.Pointer(&b[0]), C.uint(len(b)))
+	case ColDate:
+		t, isTime := value.(time.Time)
+		if !isTime {
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+		od, err := newOCIDate(co.conn.cHandle(), t)
+		if err != nil {
+			return err
+		}
+		defer C.OCI_DateFree(od)
+		ok = C.OCI_ElemSetDate(elem, od)
+	case ColTimestamp:
+		t, isTime := value.(time.Time)
+		if !isTime {
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+		ts, err := newOCITimestamp(co.conn.cHandle(), a.subType, t)
+		if err != nil {
+			return err
+		}
+		defer C.OCI_TimestampFree(ts)
+		ok = C.OCI_ElemSetTimestamp(elem, ts)
+	case ColInterval:
+		oi, err := newOCIInterval(co.conn.cHandle(), a.subType, value)
+		if err != nil {
+			return err
+		}
+		defer C.OCI_IntervalFree(oi)
+		ok = C.OCI_ElemSetInterval(elem, oi)
+	case ColLob:
+		switch x := value.(type) {
+		case *LOB:
+			if err := x.Flush(); err != nil {
+				return err
+			}
+			ok = C.OCI_ElemSetLob(elem, x.handle)
+		case LOB:
+			ok = C.OCI_ElemSetLob(elem, x.handle)
+		default:
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+	case ColObject:
+		switch x := value.(type) {
+		case *Object:
+			ok = C.OCI_ElemSetObject(elem, x.handle)
+		case Object:
+			ok = C.OCI_ElemSetObject(elem, x.handle)
+		default:
+			if rv.Kind() != reflect.Struct || a.ObjectType == nil {
+				return fmt.Errorf("cannot set %T as %s", value, a.Type)
+			}
+			obj, err := co.conn.newObject(a.ObjectType)
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			if err = obj.FromStruct(value); err != nil {
+				return err
+			}
+			ok = C.OCI_ElemSetObject(elem, obj.handle)
+		}
+	case ColRef:
+		switch x := value.(type) {
+		case *Ref:
+			ok = C.OCI_ElemSetRef(elem, x.handle)
+		case Ref:
+			ok = C.OCI_ElemSetRef(elem, x.handle)
+		default:
+			return fmt.Errorf("cannot set %T as %s", value, a.Type)
+		}
+	case ColCollection:
+		sub, free, err := co.conn.toColl(a.ObjectType, value)
+		if err != nil {
+			return err
+		}
+		defer free()
+		ok = C.OCI_ElemSetColl(elem, sub.handle)
+	default:
+		return fmt.Errorf("unsupported element type %s", a.Type)
+	}
+	if ok != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// toColl returns value as a collection of type typ: a Coll as is,
+// a slice converted with FromSlice into a temporary collection, freed by free.
+func (conn *Connection) toColl(typ *ObjectType, value interface{}) (co *Coll, free func(), err error) {
+	switch x := value.(type) {
+	case *Coll:
+		return x, func() {}, nil
+	case Coll:
+		return &x, func() {}, nil
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() != reflect.Slice || typ == nil {
+		return nil, nil, fmt.Errorf("cannot set %T as %s", value, ColCollection)
+	}
+	if co, err = conn.newColl(typ); err != nil {
+		return nil, nil, err
+	}
+	if err = co.FromSlice(value); err != nil {
+		co.Close()
+		return nil, nil, err
+	}
+	return co, func() { co.Close() }, nil
+}
+
+// ToSlice copies the elements into the slice dst points to.
+// The object elements can be copied into structs (see Object.ToStruct).
+func (co *Coll) ToSlice(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ToSlice: dst must be a non-nil pointer to a slice, not %T", dst)
+	}
+	v = v.Elem()
+	n := co.Len()
+	s := reflect.MakeSlice(v.Type(), n, n)
+	mode := fieldNumberMode(v.Type().Elem(), co.numberMode)
+	for i := 0; i < n; i++ {
+		val, err := co.get(i, mode)
+		if err != nil {
+			return fmt.Errorf("ToSlice: %v", err)
+		}
+		if err = assignAttr(s.Index(i), val); err != nil {
+			return fmt.Errorf("ToSlice: element %d: %v", i, err)
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// FromSlice replaces the elements of the collection with the elements of src,
+// which must be a slice or an array (or a pointer to one).
+func (co *Coll) FromSlice(src interface{}) error {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("FromSlice: src must be a slice, not %T", src)
+	}
+	if err := co.Clear(); err != nil {
+		return fmt.Errorf("FromSlice: %v", err)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := co.Append(v.Index(i).Interface()); err != nil {
+			return fmt.Errorf("FromSlice: element %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// bindSlice binds the slice as a collection of the named type.
+// A pointer is bound as IN OUT: the slice is filled back after the execution,
+// and a nil pointer is bound as NULL.
+func (stmt *Statement) bindSlice(name, typeName string, v interface{}) error {
+	co, err := stmt.conn.NewColl(typeName)
+	if err != nil {
+		return fmt.Errorf("BindName(%s): %v", name, err)
+	}
+	stmt.colls = append(stmt.colls, co)
+	rv := reflect.ValueOf(v)
+	isNil := rv.Kind() == reflect.Ptr && rv.IsNil()
+	if !isNil {
+		if err = co.FromSlice(v); err != nil {
+			return fmt.Errorf("BindName(%s): %v", name, err)
+		}
+	}
+	nm := C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	if C.OCI_BindColl(stmt.handle, nm, co.handle) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	bnd := C.OCI_GetBind2(stmt.handle, nm)
+	if isNil && C.OCI_BindSetNull(bnd) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	if rv.Kind() != reflect.Ptr || isNil {
+		return nil
+	}
+	stmt.outs = append(stmt.outs, func() error {
+		if C.OCI_BindIsNull(bnd) == C.TRUE {
+			rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+			return nil
+		}
+		if err := co.ToSlice(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// ListValue is a number or string slice to be bound as a collection, see List.
+type ListValue struct {
+	values interface{}
+}
+
+// List returns the number or string slice for binding as a SYS.ODCINUMBERLIST
+// or SYS.ODCIVARCHAR2LIST collection in any statement, such as in
+// "DELETE FROM t WHERE id IN (SELECT column_value FROM TABLE(:ids))"
+// (without List, the slices are bound so only in queries).
+func List(values interface{}) ListValue {
+	return ListValue{values: values}
+}
+
+// selectListType returns the built-in collection type for binding the slice
+// in a query, such as in "WHERE id IN (SELECT column_value FROM TABLE(:ids))";
+// "" if the slice is not a number or string slice.
+func selectListType(value interface{}) string {
+	switch value.(type) {
+	case []int, []int32, []int64, []uint, []uint32, []uint64, []float32, []float64, []Number:
+		return "SYS.ODCINUMBERLIST"
+	case []string:
+		return "SYS.ODCIVARCHAR2LIST"
+	}
+	return ""
+}
@@ -16,7 +16,6 @@ limitations under the License.
 
 package gocilib
 
-// #cgo LDFLAGS: -locilib
 // #include "ocilib.h"
 //
 // // extern int initialize();
@@ -24,22 +23,14 @@ import "C"
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
-
-	"gopkg.in/inconshreveable/log15.v2"
 )
 
-// Log os a log15.Logger - use gocilib.Log.SetHandler to set it to logging,
-// as by default it uses log15.DiscardHandler.
-var Log = log15.New("lib", "gocilib")
-
-func init() {
-	Log.SetHandler(log15.DiscardHandler())
-}
-
 //SplitDSN splits username/password@sid
 func SplitDSN(dsn string) (username, password, sid string) {
 	if i := strings.LastIndex(dsn, "@"); i >= 0 {
@@ -69,6 +60,16 @@ func SplitDSN(dsn string) (username, password, sid string) {
 
 type Connection struct {
 	handle *C.OCI_Connection
+	pool   *Pool
+
+	// serverOutput receives the DBMS_OUTPUT lines, see ServerOutputTo.
+	serverOutput io.Writer
+	// tracer traces the calls, see SetTracer.
+	tracer Tracer
+
+	// types caches the described object types, see ObjectType.
+	typesMu sync.Mutex
+	types   map[*C.OCI_TypeInfo]*ObjectType
 }
 
 var (
@@ -79,17 +80,33 @@ var (
 
 // NewConnection creates a new connection to the database, and connects to it.
 // user, passwd, sid can be extracted from a user/passwd@sid text with SplitDSN.
+//
+// The session is not initialized: call InitSession on the new connection
+// (the Pool and the database/sql driver do so for each of their connections).
 func NewConnection(user, passwd, sid string) (*Connection, error) {
+	return NewConnectionTracer(user, passwd, sid, nil)
+}
+
+// NewConnectionTracer is like NewConnection, but traces the connection
+// (including the connect) with tracer, if not nil.
+func NewConnectionTracer(user, passwd, sid string, tracer Tracer) (*Connection, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	initialize()
 	connNumMu.Lock()
+	start := time.Now()
 	conn := Connection{
 		handle: C.OCI_ConnectionCreate(C.CString(sid), C.CString(user), C.CString(passwd),
 			C.OCI_SESSION_DEFAULT),
+		tracer: tracer,
 	}
 	if conn.handle == nil {
 		connNumMu.Unlock()
-		return nil, getLastErr()
+		err := getLastErr()
+		conn.trace(TraceEvent{Kind: TraceConnect, Target: user + "@" + sid, Duration: time.Since(start), Err: err})
+		return nil, err
 	}
+	conn.trace(TraceEvent{Kind: TraceConnect, Target: user + "@" + sid, Duration: time.Since(start)})
 	connNum++
 	connNumMu.Unlock()
 	return &conn, (&conn).SetAutoCommit(false)
@@ -103,6 +120,8 @@ func (conn *Connection) IsConnected() bool {
 }
 
 func (conn *Connection) SetAutoCommit(commit bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	c := C.int(C.TRUE)
 	if !commit {
 		c = C.FALSE
@@ -114,24 +133,37 @@ func (conn *Connection) SetAutoCommit(commit bool) error {
 }
 
 func (conn *Connection) Commit() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if conn != nil && conn.handle != nil {
+		start := time.Now()
+		var err error
 		if C.OCI_Commit(conn.handle) != C.TRUE {
-			return getLastErr()
+			err = getLastErr()
 		}
+		conn.trace(TraceEvent{Kind: TraceCommit, Duration: time.Since(start), Err: err})
+		return err
 	}
 	return nil
 }
 
 func (conn *Connection) Rollback() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if conn != nil && conn.handle != nil {
+		start := time.Now()
+		var err error
 		if C.OCI_Rollback(conn.handle) != C.TRUE {
-			return getLastErr()
+			err = getLastErr()
 		}
+		conn.trace(TraceEvent{Kind: TraceRollback, Duration: time.Since(start), Err: err})
+		return err
 	}
 	return nil
 }
 
-// Close closes the connection, and cleans up if this was the last connection
+// Close closes the connection, and cleans up if this was the last connection.
+// Connections got from a Pool are returned to the pool instead.
 func (conn *Connection) Close() error {
 	var err error
 	if conn.handle != nil {
@@ -140,6 +172,10 @@ func (conn *Connection) Close() error {
 		}
 		conn.handle = nil
 	}
+	if conn.pool != nil {
+		conn.pool.release()
+		return err
+	}
 	connNumMu.Lock()
 	connNum--
 	if connNum <= 0 {
@@ -150,11 +186,34 @@ func (conn *Connection) Close() error {
 	return err
 }
 
+// InitSession executes the cmds (such as "ALTER SESSION SET ..."), then calls
+// hook (if not nil), to initialize the session of a new connection.
+func (conn *Connection) InitSession(cmds []string, hook func(*Connection) error) error {
+	if len(cmds) > 0 {
+		stmt, err := conn.NewStatement()
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, qry := range cmds {
+			if err = stmt.Execute(qry); err != nil {
+				return fmt.Errorf("%s: %w", qry, err)
+			}
+		}
+	}
+	if hook != nil {
+		return hook(conn)
+	}
+	return nil
+}
+
 // SetServerOutpit is like "SET SERVEROUTPUT ON SIZE bufsize" in SQL*PLUS.
 // bufsize's minimal value is 2000, maximal value is 1000000.
 //
 // If bufsize <= 0, then the server output is disabled.
 func (conn *Connection) SetServerOutput(bufsize int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if bufsize <= 0 {
 		if C.TRUE != C.OCI_ServerDisableOutput(conn.handle) {
 			return getLastErr()
@@ -194,25 +253,40 @@ func (conn *Connection) GetServerOutput(lines []string, max int) []string {
 	return lines
 }
 
-func getLastErr() error {
-	ociErr := C.OCI_GetLastError()
-	if ociErr == nil {
-		return nil
+// maxServerOutputSize is the maximal DBMS_OUTPUT buffer size.
+const maxServerOutputSize = 1000000
+
+// ServerOutputTo enables DBMS_OUTPUT, and writes its lines (each terminated
+// by a newline) to w after each Execute and BindExecute of the statements
+// of this connection, even if the execution fails.
+// Write errors are ignored.
+//
+// If w is nil, then the server output is disabled.
+func (conn *Connection) ServerOutputTo(w io.Writer) error {
+	if w == nil {
+		conn.serverOutput = nil
+		return conn.SetServerOutput(0)
 	}
-	code := int(C.OCI_ErrorGetOCICode(ociErr))
-	if code == 0 {
-		code = -1
+	if err := conn.SetServerOutput(maxServerOutputSize); err != nil {
+		return err
 	}
-	return &Error{Code: code, Text: C.GoString(C.OCI_ErrorGetString(ociErr))}
-}
-
-type Error struct {
-	Code int
-	Text string
+	conn.serverOutput = w
+	return nil
 }
 
-func (e Error) Error() string {
-	return fmt.Sprintf("%d: %s", e.Code, e.Text)
+// drainServerOutput writes all the available DBMS_OUTPUT lines to conn.serverOutput.
+func (conn *Connection) drainServerOutput() {
+	var buf []byte
+	for {
+		line := C.OCI_ServerGetOutput(conn.handle)
+		if line == nil {
+			break
+		}
+		buf = append(append(buf, C.GoString(line)...), '\n')
+	}
+	if len(buf) > 0 {
+		conn.serverOutput.Write(buf)
+	}
 }
 
 /*
@@ -0,0 +1,92 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"database/sql/driver"
+	"flag"
+	"testing"
+)
+
+var fDsn = flag.String("dsn", "", "Oracle DSN of the database tests (user/passwd@sid)")
+
+// testConnection connects to the -dsn database, and closes the connection
+// at the end of the test. The test is skipped without -dsn.
+func testConnection(t *testing.T) *Connection {
+	t.Helper()
+	if *fDsn == "" {
+		t.Skip("no -dsn given")
+	}
+	cx, err := NewConnection(SplitDSN(*fDsn))
+	if err != nil {
+		t.Fatalf("error connecting to %q: %s", *fDsn, err)
+	}
+	t.Cleanup(func() { cx.Close() })
+	return cx
+}
+
+// testStatement returns a new statement on a testConnection,
+// closed at the end of the test.
+func testStatement(t *testing.T) (*Connection, *Statement) {
+	t.Helper()
+	cx := testConnection(t)
+	st, err := cx.NewStatement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return cx, st
+}
+
+// testObject creates a database object (table, queue...) with create,
+// after removing the leftover of a previous run with drop,
+// and drops it at the end of the test.
+// The test is skipped if the object cannot be created.
+func testObject(t *testing.T, st *Statement, create, drop string) {
+	t.Helper()
+	st.Execute(drop)
+	if err := st.Execute(create); err != nil {
+		t.Skipf("%s: %v", create, err)
+	}
+	t.Cleanup(func() { st.Execute(drop) })
+}
+
+// queryRow executes qry on cx, and returns its first row.
+func queryRow(t *testing.T, cx *Connection, qry string) []driver.Value {
+	t.Helper()
+	st, err := cx.NewStatement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if err = st.Execute(qry); err != nil {
+		t.Fatalf("%s: %v", qry, err)
+	}
+	rs, err := st.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if err = rs.Next(); err != nil {
+		t.Fatalf("%s: %v", qry, err)
+	}
+	row := make([]driver.Value, len(rs.Columns()))
+	if err = rs.FetchInto(row); err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
@@ -0,0 +1,495 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+const (
+	// DirPathDateFormat is the Oracle format time.Time values are sent with.
+	DirPathDateFormat = "YYYY-MM-DD HH24:MI:SS"
+	// dirPathTimeLayout is the Go equivalent of DirPathDateFormat.
+	dirPathTimeLayout = "2006-01-02 15:04:05"
+
+	// minDirPathColSize is the minimal text size of a column without MaxSize,
+	// enough for the text form of numbers and dates.
+	minDirPathColSize = 64
+	// defaultDirPathRows is the default number of rows converted and loaded at once.
+	defaultDirPathRows = 1024
+)
+
+// ErrLoaderClosed is returned after the DirectPathLoader has been finished or aborted.
+var ErrLoaderClosed = errors.New("direct path loader closed")
+
+// DirPathColumn describes a column to be loaded.
+type DirPathColumn struct {
+	// Name is the name of the column in the table.
+	Name string
+	// MaxSize is the maximal size of the values in characters (bytes for RAW).
+	// Zero means the size of the column, but at least 64.
+	// Setting a longer value returns an error.
+	MaxSize int
+	// Format is the date or number format of the string values.
+	// time.Time values are sent in DirPathDateFormat, so leave it empty
+	// for columns loaded from time.Time values.
+	Format string
+}
+
+// DirPathOptions holds the options of a direct path load.
+type DirPathOptions struct {
+	// Partition is the name of the partition to load into (optional).
+	Partition string
+	// Rows is the number of rows converted and loaded at once (default 1024).
+	// The server may decrease it.
+	Rows int
+	// BufferSize is the size of the internal stream buffer (optional).
+	BufferSize int
+	// Parallel allows parallel loads into the same segment.
+	Parallel bool
+	// NoLog disables the redo logging of the load.
+	NoLog bool
+}
+
+// DirPathError is a row rejected by a direct path load.
+type DirPathError struct {
+	// Row is the index of the row in the input.
+	Row int64
+	// Column is the 1-based index of the column which could not be converted,
+	// 0 when the row has been rejected by the load.
+	Column int
+}
+
+func (de DirPathError) Error() string {
+	if de.Column == 0 {
+		return fmt.Sprintf("row %d: rejected", de.Row)
+	}
+	return fmt.Sprintf("row %d: column %d cannot be converted", de.Row, de.Column)
+}
+
+// DirPathErrors is returned by the DirectPathLoader when some rows have been rejected.
+type DirPathErrors []DirPathError
+
+func (de DirPathErrors) Error() string {
+	texts := make([]string, len(de))
+	for i, e := range de {
+		texts[i] = e.Error()
+	}
+	return fmt.Sprintf("%d rows rejected: %s", len(de), strings.Join(texts, "; "))
+}
+
+// DirectPathLoader loads rows into a table with the direct path API,
+// bypassing the SQL engine.
+//
+// The rows are converted and loaded in batches; the rejected rows are
+// collected and returned as DirPathErrors, the others are loaded.
+// The load must be ended with Finish (which saves the data) or Abort.
+type DirectPathLoader struct {
+	handle  *C.OCI_DirPath
+	columns []DirPathColumn
+	// limits are the maximal lengths of the column values, 0 for no limit:
+	// OCI_DirPathSetEntry silently truncates the longer ones.
+	limits []int
+	rows   int   // max rows per batch
+	next   int64 // index of the next input row
+	loaded int64
+	errs   DirPathErrors
+	done   bool // finished or aborted
+}
+
+// NewDirectPathLoader prepares a direct path load of the given columns into table.
+func (conn *Connection) NewDirectPathLoader(table string, columns []DirPathColumn, opts DirPathOptions) (*DirectPathLoader, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if len(columns) == 0 {
+		return nil, errors.New("NewDirectPathLoader: no columns")
+	}
+	Ctable := C.CString(table)
+	typinf := C.OCI_TypeInfoGet(conn.handle, Ctable, C.OCI_TIF_TABLE)
+	C.free(unsafe.Pointer(Ctable))
+	if typinf == nil {
+		return nil, getLastErr()
+	}
+	if opts.Rows <= 0 {
+		opts.Rows = defaultDirPathRows
+	}
+	var Cpart *C.char
+	if opts.Partition != "" {
+		Cpart = C.CString(opts.Partition)
+		defer C.free(unsafe.Pointer(Cpart))
+	}
+	dpl := DirectPathLoader{
+		handle:  C.OCI_DirPathCreate(typinf, Cpart, C.uint(len(columns)), C.uint(opts.Rows)),
+		columns: columns,
+	}
+	if dpl.handle == nil {
+		return nil, getLastErr()
+	}
+	if err := dpl.prepare(typinf, opts); err != nil {
+		C.OCI_DirPathFree(dpl.handle)
+		return nil, err
+	}
+	return &dpl, nil
+}
+
+// prepare sets the options and the columns, and prepares the load.
+func (dpl *DirectPathLoader) prepare(typinf *C.OCI_TypeInfo, opts DirPathOptions) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	h := dpl.handle
+	if opts.BufferSize > 0 && C.OCI_DirPathSetBufferSize(h, C.uint(opts.BufferSize)) != C.TRUE {
+		return getLastErr()
+	}
+	if opts.Parallel && C.OCI_DirPathSetParallel(h, C.TRUE) != C.TRUE {
+		return getLastErr()
+	}
+	if opts.NoLog && C.OCI_DirPathSetNoLog(h, C.TRUE) != C.TRUE {
+		return getLastErr()
+	}
+	// discard and report the erred rows, instead of stopping at the first one
+	if C.OCI_DirPathSetConvertMode(h, C.OCI_DCM_FORCE) != C.TRUE {
+		return getLastErr()
+	}
+	Cfmt := C.CString(DirPathDateFormat)
+	ok := C.OCI_DirPathSetDateFormat(h, Cfmt)
+	C.free(unsafe.Pointer(Cfmt))
+	if ok != C.TRUE {
+		return getLastErr()
+	}
+
+	n := C.OCI_TypeInfoGetColumnCount(typinf)
+	sizes := make(map[string]int, n)
+	types := make(map[string]C.uint, n)
+	for i := C.uint(1); i <= n; i++ {
+		col := C.OCI_TypeInfoGetColumn(typinf, i)
+		name := strings.ToUpper(C.GoString(C.OCI_ColumnGetName(col)))
+		sizes[name], types[name] = int(C.OCI_ColumnGetSize(col)), C.OCI_ColumnGetType(col)
+	}
+	dpl.limits = make([]int, len(dpl.columns))
+	for i, col := range dpl.columns {
+		size := col.MaxSize
+		if size <= 0 {
+			if size = sizes[strings.ToUpper(col.Name)]; size < minDirPathColSize {
+				size = minDirPathColSize
+			}
+		}
+		// OCILIB truncates the values to the column's size in bytes,
+		// so text columns get room for size characters.
+		dpl.limits[i] = size
+		Csize := size
+		switch types[strings.ToUpper(col.Name)] {
+		case C.OCI_CDT_TEXT:
+			Csize = size * utf8.UTFMax
+		case C.OCI_CDT_NUMERIC:
+			if col.Format != "" { // converted to OCINumber with the format
+				dpl.limits[i] = 0
+			}
+		case C.OCI_CDT_DATETIME, C.OCI_CDT_TIMESTAMP, C.OCI_CDT_INTERVAL:
+			if col.Format != "" { // truncated to the length of the format
+				dpl.limits[i] = len(col.Format)
+			}
+		}
+		Cname := C.CString(col.Name)
+		var Cformat *C.char
+		if col.Format != "" {
+			Cformat = C.CString(col.Format)
+		}
+		ok := C.OCI_DirPathSetColumn(h, C.uint(i+1), Cname, C.uint(Csize), Cformat)
+		C.free(unsafe.Pointer(Cname))
+		if Cformat != nil {
+			C.free(unsafe.Pointer(Cformat))
+		}
+		if ok != C.TRUE {
+			return fmt.Errorf("SetColumn(%s): %v", col.Name, getLastErr())
+		}
+	}
+	if C.OCI_DirPathPrepare(h) != C.TRUE {
+		return getLastErr()
+	}
+	dpl.rows = int(C.OCI_DirPathGetMaxRows(h))
+	if dpl.rows <= 0 {
+		dpl.rows = 1
+	}
+	return nil
+}
+
+// LoadChan loads the rows received from the channel, till it is closed.
+// Each row must hold a value for each column.
+//
+// Returns the number of loaded rows, and DirPathErrors if some rows are rejected.
+func (dpl *DirectPathLoader) LoadChan(rows <-chan []interface{}) (int64, error) {
+	return dpl.LoadIter(func() ([]interface{}, error) {
+		row, ok := <-rows
+		if !ok {
+			return nil, io.EOF
+		}
+		return row, nil
+	})
+}
+
+// LoadIter loads the rows returned by next, till it returns io.EOF.
+// Each row must hold a value for each column.
+//
+// Returns the number of loaded rows, and DirPathErrors if some rows are rejected.
+func (dpl *DirectPathLoader) LoadIter(next func() ([]interface{}, error)) (int64, error) {
+	if dpl.handle == nil {
+		return 0, ErrLoaderClosed
+	}
+	loaded, nErrs := dpl.loaded, len(dpl.errs)
+	batch := make([][]interface{}, 0, dpl.rows)
+	for {
+		row, err := next()
+		if err != nil {
+			if err != io.EOF {
+				return dpl.loaded - loaded, err
+			}
+			break
+		}
+		if len(row) != len(dpl.columns) {
+			return dpl.loaded - loaded, fmt.Errorf("row %d has %d values, wanted %d", dpl.next+int64(len(batch)), len(row), len(dpl.columns))
+		}
+		if batch = append(batch, row); len(batch) == cap(batch) {
+			if err := dpl.load(batch); err != nil {
+				return dpl.loaded - loaded, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := dpl.load(batch); err != nil {
+			return dpl.loaded - loaded, err
+		}
+	}
+	if len(dpl.errs) > nErrs {
+		return dpl.loaded - loaded, dpl.errs[nErrs:]
+	}
+	return dpl.loaded - loaded, nil
+}
+
+// load converts and loads the batch of rows.
+//
+// When the stream gets full, the converted rows are loaded,
+// and the conversion restarts with the remaining rows.
+func (dpl *DirectPathLoader) load(batch [][]interface{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	h := dpl.handle
+	for len(batch) > 0 {
+		if C.OCI_DirPathReset(h) != C.TRUE {
+			return getLastErr()
+		}
+		if C.OCI_DirPathSetCurrentRows(h, C.uint(len(batch))) != C.TRUE {
+			return getLastErr()
+		}
+		for i, row := range batch {
+			for j, v := range row {
+				if err := dpl.setEntry(i+1, j+1, v); err != nil {
+					return fmt.Errorf("row %d column %s: %v", dpl.next+int64(i), dpl.columns[j].Name, err)
+				}
+			}
+		}
+
+		state := C.OCI_DirPathConvert(h)
+		switch state {
+		case C.OCI_DPR_COMPLETE, C.OCI_DPR_FULL:
+		case C.OCI_DPR_EMPTY: // no data to convert
+			state = C.OCI_DPR_COMPLETE
+		default:
+			return getLastErr()
+		}
+		rejected := make(map[int]bool)
+		for {
+			row, col := int(C.OCI_DirPathGetErrorRow(h)), int(C.OCI_DirPathGetErrorColumn(h))
+			if row == 0 {
+				break
+			}
+			rejected[row-1] = true
+			dpl.errs = append(dpl.errs, DirPathError{Row: dpl.next + int64(row-1), Column: col})
+		}
+		consumed := len(batch)
+		if state == C.OCI_DPR_FULL {
+			if consumed = int(C.OCI_DirPathGetAffectedRows(h)) + len(rejected); consumed == 0 {
+				return errors.New("direct path stream buffer is too small for a row")
+			}
+		}
+		// the stream holds the converted rows, without the rejected ones
+		stream := make([]int64, 0, consumed-len(rejected))
+		for i := 0; i < consumed; i++ {
+			if !rejected[i] {
+				stream = append(stream, dpl.next+int64(i))
+			}
+		}
+
+		switch C.OCI_DirPathLoad(h) {
+		case C.OCI_DPR_COMPLETE, C.OCI_DPR_EMPTY:
+		default:
+			return getLastErr()
+		}
+		for {
+			row := int(C.OCI_DirPathGetErrorRow(h))
+			if row == 0 {
+				break
+			}
+			idx := dpl.next + int64(row-1)
+			if row <= len(stream) {
+				idx = stream[row-1]
+			}
+			dpl.errs = append(dpl.errs, DirPathError{Row: idx})
+		}
+		dpl.loaded += int64(C.OCI_DirPathGetAffectedRows(h))
+
+		dpl.next += int64(consumed)
+		batch = batch[consumed:]
+	}
+	return nil
+}
+
+// setEntry sets the value of the row/column entry, in text form.
+// nil is sent as NULL.
+func (dpl *DirectPathLoader) setEntry(row, col int, v interface{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var text string
+	switch x := v.(type) {
+	case nil:
+		if C.OCI_DirPathSetEntry(dpl.handle, C.uint(row), C.uint(col), nil, 0, C.TRUE) != C.TRUE {
+			return getLastErr()
+		}
+		return nil
+	case []byte:
+		if x == nil {
+			return dpl.setEntry(row, col, nil)
+		}
+		text = string(x)
+	case string:
+		text = x
+	case time.Time:
+		text = x.Format(dirPathTimeLayout)
+	case int:
+		text = strconv.Itoa(x)
+	case int32:
+		text = strconv.FormatInt(int64(x), 10)
+	case int64:
+		text = strconv.FormatInt(x, 10)
+	case uint:
+		text = strconv.FormatUint(uint64(x), 10)
+	case uint32:
+		text = strconv.FormatUint(uint64(x), 10)
+	case uint64:
+		text = strconv.FormatUint(x, 10)
+	case float32:
+		text = strconv.FormatFloat(float64(x), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			text = "1"
+		} else {
+			text = "0"
+		}
+	default:
+		text = fmt.Sprint(v)
+	}
+	if limit := dpl.limits[col-1]; limit > 0 {
+		n := utf8.RuneCountInString(text)
+		if _, ok := v.([]byte); ok {
+			n = len(text)
+		}
+		if n > limit {
+			return fmt.Errorf("value of length %d is longer than the MaxSize %d", n, limit)
+		}
+	}
+	// OCILIB copies the value, and needs it zero-terminated for formatted numbers
+	Ctext := C.CString(text)
+	defer C.free(unsafe.Pointer(Ctext))
+	if C.OCI_DirPathSetEntry(dpl.handle, C.uint(row), C.uint(col),
+		unsafe.Pointer(Ctext), C.uint(len(text)), C.TRUE) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Finish saves the loaded data, and frees the loader.
+func (dpl *DirectPathLoader) Finish() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if dpl.handle == nil {
+		return ErrLoaderClosed
+	}
+	var err error
+	if C.OCI_DirPathFinish(dpl.handle) != C.TRUE {
+		err = getLastErr()
+	} else {
+		dpl.done = true
+	}
+	if closeErr := dpl.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Abort terminates the load without saving, and frees the loader.
+func (dpl *DirectPathLoader) Abort() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if dpl.handle == nil {
+		return ErrLoaderClosed
+	}
+	var err error
+	if C.OCI_DirPathAbort(dpl.handle) != C.TRUE {
+		err = getLastErr()
+	}
+	dpl.done = true
+	if closeErr := dpl.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close frees the loader. An unfinished load is aborted.
+func (dpl *DirectPathLoader) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if dpl.handle == nil {
+		return nil
+	}
+	if !dpl.done {
+		C.OCI_DirPathAbort(dpl.handle)
+	}
+	var err error
+	if C.OCI_DirPathFree(dpl.handle) != C.TRUE {
+		err = fmt.Errorf("error freeing direct path %p: %v", dpl.handle, getLastErr())
+	}
+	dpl.handle = nil
+	return err
+}
+
+// Loaded returns the number of rows loaded so far.
+func (dpl *DirectPathLoader) Loaded() int64 {
+	return dpl.loaded
+}
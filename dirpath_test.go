@@ -0,0 +1,85 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectPath(t *testing.T) {
+	cx, st := testStatement(t)
+	testObject(t, st, "CREATE TABLE tst_gocilib_dp (id NUMBER(10), name VARCHAR2(20), dt DATE)",
+		"DROP TABLE tst_gocilib_dp")
+
+	columns := []DirPathColumn{{Name: "ID"}, {Name: "NAME", MaxSize: 5}, {Name: "DT"}}
+	dt := time.Date(2014, 3, 29, 12, 34, 56, 0, time.Local)
+	// two rows per batch, so the rows are loaded in three batches
+	dpl, err := cx.NewDirectPathLoader("tst_gocilib_dp", columns, DirPathOptions{Rows: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dpl.Close()
+	var i int
+	n, err := dpl.LoadIter(func() ([]interface{}, error) {
+		if i == 5 {
+			return nil, io.EOF
+		}
+		i++
+		if i == 3 {
+			return []interface{}{i, nil, nil}, nil
+		}
+		return []interface{}{i, "tűz" + strconv.Itoa(i), dt}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || dpl.Loaded() != 5 {
+		t.Errorf("loaded %d (%d) rows, wanted 5", n, dpl.Loaded())
+	}
+	if err = dpl.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dpl.LoadIter(func() ([]interface{}, error) { return nil, io.EOF }); err != ErrLoaderClosed {
+		t.Errorf("wanted ErrLoaderClosed after Finish, got %v", err)
+	}
+
+	if row := queryRow(t, cx, "SELECT COUNT(0), COUNT(name), MAX(name), MAX(dt) FROM tst_gocilib_dp"); row[0] != int64(5) || row[1] != int64(4) || row[2] != "tűz5" || !dt.Equal(row[3].(time.Time)) {
+		t.Errorf("got %#v", row)
+	}
+
+	// a value longer than MaxSize is an error, not silently truncated
+	if dpl, err = cx.NewDirectPathLoader("tst_gocilib_dp", columns, DirPathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	defer dpl.Close()
+	rows := make(chan []interface{}, 1)
+	rows <- []interface{}{6, "árvíztűrő", dt}
+	close(rows)
+	if _, err = dpl.LoadChan(rows); err == nil || !strings.Contains(err.Error(), "MaxSize") {
+		t.Errorf("wanted MaxSize error, got %v", err)
+	}
+	if err = dpl.Abort(); err != nil {
+		t.Error(err)
+	}
+	if row := queryRow(t, cx, "SELECT COUNT(0) FROM tst_gocilib_dp"); row[0] != int64(5) {
+		t.Errorf("got %v rows after Abort, wanted 5", row[0])
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/tgulacsi/gocilib"
+)
+
+// Config holds the connection parameters, for NewConnector.
+type Config struct {
+	// Username, Password and SID identify the database and the user.
+	// SID can be a TNS alias or an EZConnect string (host:port/service).
+	Username, Password, SID string
+
+	// AutoCommit commits after each statement.
+	AutoCommit bool
+
+	// PrefetchRows and PrefetchMemory set the fetch sizes of the statements;
+	// zero means the gocilib default.
+	PrefetchRows, PrefetchMemory uint
+
+	// NLS holds the session NLS parameters, like
+	// {"NLS_DATE_FORMAT": "YYYY-MM-DD HH24:MI:SS", "NLS_LANGUAGE": "AMERICAN"}.
+	NLS map[string]string
+
+	// InitCmds are executed on each new connection, after the NLS settings.
+	InitCmds []string
+
+	// OnConnect is called on each new connection, after InitCmds.
+	// Its error fails the connection.
+	OnConnect func(*gocilib.Connection) error
+
+	// ServerOutput, if not nil, enables DBMS_OUTPUT, and logs its lines
+	// after each execution, at Info level.
+	ServerOutput *slog.Logger
+
+	// Tracer traces the calls of the connections; nil means gocilib.DefaultTracer.
+	Tracer gocilib.Tracer
+}
+
+// ParseDSN parses a USER/PASSWD@SID string into a Config.
+func ParseDSN(dsn string) Config {
+	var cfg Config
+	cfg.Username, cfg.Password, cfg.SID = gocilib.SplitDSN(dsn)
+	return cfg
+}
+
+// String returns the USER/***@SID form, without the password.
+func (cfg Config) String() string {
+	return cfg.Username + "/***@" + cfg.SID
+}
+
+// sessionCmds returns the statements to be executed on a new connection.
+func (cfg Config) sessionCmds() []string {
+	keys := make([]string, 0, len(cfg.NLS))
+	for k := range cfg.NLS {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cmds := make([]string, 0, len(keys)+len(cfg.InitCmds))
+	for _, k := range keys {
+		cmds = append(cmds,
+			"ALTER SESSION SET "+k+" = '"+strings.Replace(cfg.NLS[k], "'", "''", -1)+"'")
+	}
+	return append(cmds, cfg.InitCmds...)
+}
+
+// slogWriter logs each written line as a DBMS_OUTPUT message.
+type slogWriter struct {
+	logger *slog.Logger
+}
+
+func (w slogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		w.logger.Info("DBMS_OUTPUT", "line", line)
+	}
+	return len(p), nil
+}
+
+type connector struct {
+	cfg Config
+	drv *Driver
+}
+
+// NewConnector returns a driver.Connector for sql.OpenDB, connecting with cfg.
+func NewConnector(cfg Config) driver.Connector {
+	return connector{cfg: cfg, drv: &d}
+}
+
+// OpenConnector parses the USER/PASSWD@SID name once, for sql.Open.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	return connector{cfg: d.config(name), drv: d}, nil
+}
+
+// Driver returns the underlying Driver.
+func (c connector) Driver() driver.Driver {
+	return c.drv
+}
+
+// Connect returns a new connection, initialized as the Config says.
+//
+// If ctx is done before the connection is established, ctx.Err() is returned,
+// and the connection is closed as soon as it arrives.
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		cx  *conn
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		cx, err := c.connect()
+		done <- result{cx: cx, err: err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return res.cx, nil
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.cx != nil {
+				res.cx.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// connect connects to the database and initializes the session.
+func (c connector) connect() (*conn, error) {
+	cx, err := gocilib.NewConnectionTracer(c.cfg.Username, c.cfg.Password, c.cfg.SID, c.cfg.Tracer)
+	if err != nil {
+		if cx != nil {
+			cx.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", c.cfg, err)
+	}
+	if c.cfg.AutoCommit {
+		if err = cx.SetAutoCommit(true); err != nil {
+			cx.Close()
+			return nil, fmt.Errorf("SetAutoCommit: %w", err)
+		}
+	}
+	if c.cfg.ServerOutput != nil {
+		if err = cx.ServerOutputTo(slogWriter{c.cfg.ServerOutput}); err != nil {
+			cx.Close()
+			return nil, fmt.Errorf("ServerOutputTo: %w", err)
+		}
+	}
+	if err = cx.InitSession(c.cfg.sessionCmds(), c.cfg.OnConnect); err != nil {
+		cx.Close()
+		return nil, fmt.Errorf("init session: %w", err)
+	}
+	return &conn{cx: cx, prefetchRows: c.cfg.PrefetchRows, prefetchMemory: c.cfg.PrefetchMemory}, nil
+}
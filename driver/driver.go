@@ -19,47 +19,45 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"strconv"
+	"log/slog"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tgulacsi/gocilib"
+	"github.com/tgulacsi/gocilib/sqlparse"
 	"gopkg.in/errgo.v1"
 )
 
 var (
 	// NotImplemented prints Not implemented
 	NotImplemented = errors.New("Not implemented")
-	// IsDebug should we print debug logs?
-	IsDebug bool
 )
 
 type conn struct {
 	cx *gocilib.Connection
+
+	prefetchRows, prefetchMemory uint
 }
 
 type stmt struct {
 	st        *gocilib.Statement
 	statement string
+	names     []string // bind names, in the order of their first occurrence
+	style     sqlparse.Style
 }
 
 // filterErr filters the error, returns driver.ErrBadConn if appropriate
 func filterErr(err *error) error {
-	//log.Printf("filterErr(%v)", err)
-	if oraErr, ok := errgo.Cause(*err).(*gocilib.Error); ok {
-		switch oraErr.Code {
-		case 115, 451, 452, 609, 1090, 1092, 1073, 3113, 3114, 3135, 3136, 12153, 12161, 12170, 12224, 12230, 12233, 12510, 12511, 12514, 12518, 12526, 12527, 12528, 12539: //connection errors - try again!
-			*err = driver.ErrBadConn
-		case 0:
-			if oraErr.Text == "" {
-				*err = nil
-			}
-		}
+	if *err != nil && gocilib.IsConnLost(*err) { //connection errors - try again!
+		*err = driver.ErrBadConn
 	}
 	return *err
 }
@@ -68,26 +66,55 @@ func filterErr(err *error) error {
 func (c conn) Prepare(query string) (driver.Stmt, error) {
 	st, err := c.cx.NewStatement()
 	if filterErr(&err) != nil {
-		return nil, fmt.Errorf("Prepare[creating statement]: %v", err)
+		return nil, fmt.Errorf("Prepare[creating statement]: %w", err)
 	}
-	if strings.Index(query, ":1") < 0 && strings.Index(query, "?") >= 0 {
-		q := strings.Split(query, "?")
-		q2 := make([]string, 0, 2*len(q)-1)
-		for i := 0; i < len(q); i++ {
-			if i > 0 {
-				q2 = append(q2, ":"+strconv.Itoa(i))
-			}
-			q2 = append(q2, q[i])
-		}
-		query = strings.Join(q2, "")
-		//log.Printf("%#v.Prepare(%q)", st, query)
+	if c.prefetchRows > 0 {
+		st.FetchSize = c.prefetchRows
+	}
+	if c.prefetchMemory > 0 {
+		st.PrefetchMemory = c.prefetchMemory
+	}
+	q, err := sqlparse.Rewrite(query)
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("Prepare query %q: %w", query, err)
 	}
+	query = q.SQL
 	debug("%p.Prepare(%s)", st, query)
 	err = st.Prepare(query)
 	if filterErr(&err) != nil {
-		return nil, errgo.Notef(err, "Prepare query: %q", query)
+		return nil, fmt.Errorf("Prepare query %q: %w", query, err)
 	}
-	return stmt{st: st, statement: query}, nil
+	return stmt{st: st, statement: query, names: q.Names, style: q.Style}, nil
+}
+
+// CheckNamedValue converts sql.Out to gocilib.Out, accepts the gocilib types,
+// the gocilib.ObjectTypeNamer structs and slices, time.Duration and slices
+// (for array binds, or collections in queries) as is, and leaves the rest
+// to the default conversion.
+func (c conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch x := nv.Value.(type) {
+	case sql.Out:
+		if _, ok := x.Dest.(gocilib.ObjectTypeNamer); ok {
+			// the struct and slice pointers are bound as IN OUT objects and collections
+			nv.Value = x.Dest
+			return nil
+		}
+		nv.Value = gocilib.Out{Dest: x.Dest, In: x.In}
+		return nil
+	case gocilib.Out, *gocilib.Out, gocilib.PLSQLArray, *gocilib.PLSQLArray,
+		gocilib.LOB, *gocilib.LOB, gocilib.File, gocilib.Object, *gocilib.Object,
+		gocilib.Coll, *gocilib.Coll, gocilib.Ref, *gocilib.Ref, gocilib.ObjectTypeNamer,
+		gocilib.Long, gocilib.StringVar, *gocilib.StringVar, gocilib.TimeAs,
+		gocilib.YearMonthInterval, gocilib.DaySecondInterval, gocilib.ListValue, time.Duration:
+		return nil
+	case []byte, driver.Valuer:
+		return driver.ErrSkip
+	}
+	if nv.Value != nil && reflect.TypeOf(nv.Value).Kind() == reflect.Slice {
+		return nil
+	}
+	return driver.ErrSkip
 }
 
 // closes the connection
@@ -103,9 +130,30 @@ type tx struct {
 
 // begins a transaction
 func (c conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx begins a transaction with the isolation level and read-only mode of opts.
+func (c conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
 	if !c.cx.IsConnected() {
 		return nil, errgo.New("not connected")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	txOpts := gocilib.TxOptions{ReadOnly: opts.ReadOnly}
+	switch sql.IsolationLevel(opts.Isolation) {
+	case sql.LevelDefault:
+	case sql.LevelReadCommitted:
+		txOpts.Isolation = gocilib.ReadCommitted
+	case sql.LevelSerializable:
+		txOpts.Isolation = gocilib.Serializable
+	default:
+		return nil, errgo.Newf("isolation level %s is not supported", sql.IsolationLevel(opts.Isolation))
+	}
+	if err := c.cx.BeginTx(txOpts); filterErr(&err) != nil {
+		return nil, fmt.Errorf("BeginTx: %w", err)
+	}
 	return tx{cx: c.cx}, nil
 }
 
@@ -135,23 +183,29 @@ func (s stmt) Close() error {
 	return nil
 }
 
-// number of input parameters
+// number of input parameters: the number of distinct placeholders,
+// or -1 for CREATE statements (:new and :old in triggers are not binds)
 func (s stmt) NumInput() int {
-	bindCount, err := s.st.BindCount()
-	if err != nil {
-		log.Printf("ERROR getting bind count: %v", err)
-		return 0
+	if s.style == sqlparse.Oracle {
+		if qry := strings.TrimSpace(s.statement); len(qry) >= 6 && strings.EqualFold(qry[:6], "CREATE") {
+			return -1
+		}
 	}
-	return bindCount
+	return len(s.names)
 }
 
 type rowsRes struct {
+	ctx  context.Context
+	st   *gocilib.Statement
 	rs   *gocilib.Resultset
 	cols []gocilib.ColDesc
+	next *gocilib.Resultset // the next resultset, got by HasNextResultSet
+	// nextErr is the error of getting the next resultset, returned by NextResultSet
+	nextErr error
 }
 
 // executes the statement
-func (s stmt) run(args []driver.Value) (*rowsRes, error) {
+func (s stmt) run(ctx context.Context, args []driver.NamedValue) (*rowsRes, error) {
 	//A driver Value is a value that drivers must be able to handle.
 	//A Value is either nil or an instance of one of these types:
 	//int64
@@ -160,29 +214,89 @@ func (s stmt) run(args []driver.Value) (*rowsRes, error) {
 	//[]byte
 	//string   [*] everywhere except from Rows.Next.
 	//time.Time
+	//
+	//plus the types accepted by CheckNamedValue.
 
-	var err error
+	posArgs, nameArgs, err := s.splitArgs(args)
+	if err != nil {
+		return nil, err
+	}
 	//log.Printf("%#v.BindExecute(%#v, %#v)", s.st, s.statement, args)
-	if err = s.st.BindExecute(s.statement, args, nil); filterErr(&err) != nil {
-		return nil, errgo.Notef(err, "BindExec%#v %q", args, s.statement)
+	if err = s.st.BindExecuteContext(ctx, s.statement, posArgs, nameArgs); filterErr(&err) != nil {
+		return nil, fmt.Errorf("BindExec%#v %q: %w", args, s.statement, err)
 	}
 
 	rs, err := s.st.Results()
 	//log.Printf("%#v.Results(): %#v, %v", s.st, rs, err)
 	if filterErr(&err) != nil {
-		return nil, errgo.Notef(err, "BindExec %q", s.statement)
+		return nil, fmt.Errorf("BindExec %q: %w", s.statement, err)
 	}
-	rr := &rowsRes{rs: rs, cols: rs.Columns()}
+	rr := &rowsRes{ctx: ctx, st: s.st, rs: rs, cols: rs.Columns()}
 	//log.Printf("%#v.run(%#v): %#v", s, args, rr)
 	return rr, nil
 }
 
+// splitArgs splits the args to positional and named binds.
+//
+// The ordinal args of statements with :name or @name placeholders are bound
+// to the name at that position; the others by position.
+func (s stmt) splitArgs(args []driver.NamedValue) ([]driver.Value, map[string]driver.Value, error) {
+	var (
+		posArgs  []driver.Value
+		nameArgs map[string]driver.Value
+	)
+	byName := s.style == sqlparse.Oracle || s.style == sqlparse.At
+	for _, a := range args {
+		name := a.Name
+		if name == "" {
+			if !byName {
+				if a.Ordinal != len(posArgs)+1 {
+					return nil, nil, errgo.Newf("ordinal argument %d after a named one", a.Ordinal)
+				}
+				posArgs = append(posArgs, a.Value)
+				continue
+			}
+			if a.Ordinal < 1 || a.Ordinal > len(s.names) {
+				return nil, nil, errgo.Newf("argument %d: the statement has only %d placeholders", a.Ordinal, len(s.names))
+			}
+			name = s.names[a.Ordinal-1]
+		}
+		if nameArgs == nil {
+			nameArgs = make(map[string]driver.Value, len(args))
+		}
+		if name[0] != ':' {
+			name = ":" + name
+		}
+		nameArgs[name] = a.Value
+	}
+	return posArgs, nameArgs, nil
+}
+
 func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
-	return s.run(args)
+	return s.run(context.Background(), ordinalValues(args))
 }
 
 func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
-	return s.run(args)
+	return s.run(context.Background(), ordinalValues(args))
+}
+
+// ExecContext executes the statement, breaking it when the ctx is done.
+func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.run(ctx, args)
+}
+
+// QueryContext executes the query, breaking it or the fetches when the ctx is done.
+func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.run(ctx, args)
+}
+
+// ordinalValues converts the Values to ordinal NamedValues.
+func ordinalValues(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nvs
 }
 
 func (r rowsRes) LastInsertId() (int64, error) {
@@ -216,24 +330,62 @@ func (r rowsRes) Close() error {
 
 // DATE, DATETIME, TIMESTAMP are treated as they are in Local time zone
 func (r rowsRes) Next(dest []driver.Value) error {
-	if err := r.rs.Next(); err != nil {
+	if err := r.rs.NextContext(r.ctx); err != nil {
 		if err == io.EOF {
 			return io.EOF
 		}
-		return errgo.Mask(err)
+		return err
 	}
 	err := r.rs.FetchInto(dest)
 	//log.Printf("%#v.FetchInto(%#v): %v", r.rs, dest, err)
-	return errgo.Mask(err)
+	for i, v := range dest {
+		// ref cursors can be scanned into *sql.Rows
+		if cur, ok := v.(*gocilib.Resultset); ok {
+			dest[i] = &rowsRes{ctx: r.ctx, st: cur.Statement(), rs: cur, cols: cur.Columns()}
+		}
+	}
+	return err
+}
+
+// HasNextResultSet reports whether there is another resultset
+// (an implicit result of a PL/SQL block, see gocilib.Statement.NextResultset),
+// or an error getting it, to be returned by NextResultSet.
+func (r *rowsRes) HasNextResultSet() bool {
+	if r.next == nil && r.nextErr == nil && r.st != nil {
+		var err error
+		if r.next, err = r.st.NextResultset(); err != nil && err != io.EOF {
+			r.nextErr = err
+		}
+	}
+	return r.next != nil || r.nextErr != nil
+}
+
+// NextResultSet advances to the next resultset, or returns io.EOF.
+func (r *rowsRes) NextResultSet() error {
+	if !r.HasNextResultSet() {
+		return io.EOF
+	}
+	if r.nextErr != nil {
+		return r.nextErr
+	}
+	r.rs, r.next = r.next, nil
+	r.cols = r.rs.Columns()
+	return nil
 }
 
 // Driver implements a Driver
 type Driver struct {
+	// mu guards the defaults, as the Set functions can be called any time.
+	mu sync.Mutex
 	// Defaults
 	user, passwd, db string
 
 	initCmds   []string
+	onConnect  func(*gocilib.Connection) error
 	autocommit bool
+
+	serverOutput *slog.Logger
+	tracer       gocilib.Tracer
 }
 
 // Open new connection. The uri need to have the following syntax:
@@ -241,22 +393,35 @@ type Driver struct {
 //   USER/PASSWD@SID
 //
 // SID (database identifier) can be a DSN (see goracle/oracle.MakeDSN)
+//
+// Use OpenConnector or NewConnector to parse the uri only once.
 func (d *Driver) Open(uri string) (driver.Conn, error) {
-	// Establish the connection
-	cx, err := gocilib.NewConnection(gocilib.SplitDSN(uri))
-	if err != nil {
-		return nil, errgo.Notef(err, "%s/***@%s", d.user, d.db)
+	return connector{cfg: d.config(uri), drv: d}.connect()
+}
+
+// config parses the uri, and fills the missing parts from the defaults.
+func (d *Driver) config(uri string) Config {
+	cfg := ParseDSN(uri)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cfg.Username == "" {
+		cfg.Username, cfg.Password = d.user, d.passwd
 	}
-	if d.autocommit {
-		err = cx.SetAutoCommit(true)
+	if cfg.SID == "" {
+		cfg.SID = d.db
 	}
-	return &conn{cx: cx}, err
+	cfg.AutoCommit = d.autocommit
+	cfg.InitCmds = d.initCmds
+	cfg.OnConnect = d.onConnect
+	cfg.ServerOutput = d.serverOutput
+	cfg.Tracer = d.tracer
+	return cfg
 }
 
-// use log.Printf for log messages if IsDebug
-func debug(fmt string, args ...interface{}) {
-	if IsDebug {
-		log.Printf(fmt, args...)
+// debug logs to gocilib.Log, at Debug level.
+func debug(format string, args ...interface{}) {
+	if gocilib.Log.Enabled(context.Background(), slog.LevelDebug) {
+		gocilib.Log.Debug(fmt.Sprintf(format, args...))
 	}
 }
 
@@ -266,10 +431,43 @@ var d = Driver{}
 // SetAutoCommit sets auto commit mode for future connections
 // true is open autocommit, default false
 func SetAutoCommit(b bool) {
+	d.mu.Lock()
 	d.autocommit = b
+	d.mu.Unlock()
+}
+
+// SetInitCmds sets the statements (such as "ALTER SESSION SET ...")
+// executed on each future connection.
+func SetInitCmds(cmds ...string) {
+	d.mu.Lock()
+	d.initCmds = cmds
+	d.mu.Unlock()
+}
+
+// SetOnConnect sets the function called on each future connection,
+// after the init statements. Its error fails the connection.
+func SetOnConnect(f func(*gocilib.Connection) error) {
+	d.mu.Lock()
+	d.onConnect = f
+	d.mu.Unlock()
+}
+
+// SetServerOutput enables DBMS_OUTPUT on each future connection,
+// and logs its lines to logger. A nil logger disables it.
+func SetServerOutput(logger *slog.Logger) {
+	d.mu.Lock()
+	d.serverOutput = logger
+	d.mu.Unlock()
+}
+
+// SetTracer sets the gocilib.Tracer of each future connection.
+// nil means gocilib.DefaultTracer.
+func SetTracer(t gocilib.Tracer) {
+	d.mu.Lock()
+	d.tracer = t
+	d.mu.Unlock()
 }
 
 func init() {
-	gocilib.UseBigInt = false
 	sql.Register("gocilib", &d)
 }
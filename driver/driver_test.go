@@ -17,10 +17,20 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
+	"log/slog"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/tgulacsi/gocilib"
 )
 
 var fDsn = flag.String("dsn", "", "Oracle DSN")
@@ -152,6 +162,691 @@ func TestSelectBind(t *testing.T) {
 	t.Logf("bind: %d", id)
 }
 
+func TestConnector(t *testing.T) {
+	flag.Parse()
+	cfg := ParseDSN(*fDsn)
+	cfg.NLS = map[string]string{"NLS_DATE_FORMAT": "YYYY-MM-DD"}
+	cfg.PrefetchRows = 10
+	db := sql.OpenDB(NewConnector(cfg))
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("SELECT TO_CHAR(TO_DATE('2006-01-02', 'YYYY-MM-DD')) FROM DUAL").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "2006-01-02" {
+		t.Errorf("got %q, wanted 2006-01-02", s)
+	}
+}
+
+func TestServerOutput(t *testing.T) {
+	flag.Parse()
+	cfg := ParseDSN(*fDsn)
+	var buf bytes.Buffer
+	cfg.ServerOutput = slog.New(slog.NewTextHandler(&buf, nil))
+	db := sql.OpenDB(NewConnector(cfg))
+	defer db.Close()
+
+	if _, err := db.Exec("BEGIN DBMS_OUTPUT.PUT_LINE('árvíztűrő'); DBMS_OUTPUT.PUT_LINE('tükör'); END;"); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "line=árvíztűrő") || !strings.Contains(got, "line=tükör") {
+		t.Errorf("got %q, wanted the two lines", got)
+	}
+}
+
+func TestOnConnect(t *testing.T) {
+	flag.Parse()
+	cfg := ParseDSN(*fDsn)
+	cfg.InitCmds = []string{"BEGIN DBMS_APPLICATION_INFO.SET_MODULE('gocilib', 'test'); END;"}
+	var called bool
+	cfg.OnConnect = func(cx *gocilib.Connection) error {
+		called = true
+		return nil
+	}
+	db := sql.OpenDB(NewConnector(cfg))
+	defer db.Close()
+	var module string
+	if err := db.QueryRow("SELECT SYS_CONTEXT('USERENV', 'MODULE') FROM DUAL").Scan(&module); err != nil {
+		t.Fatal(err)
+	}
+	if !called || module != "gocilib" {
+		t.Errorf("OnConnect called=%t module=%q", called, module)
+	}
+
+	errFail := errors.New("fail")
+	cfg.OnConnect = func(cx *gocilib.Connection) error { return errFail }
+	db2 := sql.OpenDB(NewConnector(cfg))
+	defer db2.Close()
+	if err := db2.Ping(); err == nil {
+		t.Errorf("wanted error from OnConnect, got nil")
+	}
+}
+
+func TestReadOnlyTx(t *testing.T) {
+	conn := getConnection(t)
+	conn.Exec("DROP TABLE tst_gocilib_ro")
+	if _, err := conn.Exec("CREATE TABLE tst_gocilib_ro (x NUMBER)"); err != nil {
+		t.Skip(err)
+	}
+	defer conn.Exec("DROP TABLE tst_gocilib_ro")
+
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO tst_gocilib_ro (x) VALUES (1)")
+	if oraErr, ok := gocilib.AsError(err); !ok || oraErr.Code != 1456 {
+		t.Errorf("wanted ORA-01456, got %v", err)
+	}
+}
+
+func TestNamed(t *testing.T) {
+	conn := getConnection(t)
+	var a, b string
+	if err := conn.QueryRow("SELECT :a||'-'||:b, :a FROM DUAL",
+		sql.Named("b", "B"), sql.Named("a", "A"),
+	).Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a != "A-B" || b != "A" {
+		t.Errorf("got %q, %q, wanted A-B, A", a, b)
+	}
+
+	var d string
+	if err := conn.QueryRow("SELECT TO_CHAR(@d) FROM DUAL", sql.Named("d", time.Hour)).Scan(&d); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("interval: %q", d)
+}
+
+func TestNumber(t *testing.T) {
+	conn := getConnection(t)
+	const big = "123456789012345678901234567890.123456789"
+	var n gocilib.Number
+	if err := conn.QueryRow("SELECT TO_NUMBER(:1) + 0 FROM DUAL", gocilib.Number(big)).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != big {
+		t.Errorf("got %q, wanted %q", n, big)
+	}
+	if _, err := n.BigRat(); err != nil {
+		t.Error(err)
+	}
+
+	// beyond the 38 digits and 24 decimals of OCILIB's default number format
+	for _, want := range []gocilib.Number{
+		"12345678901234567890123456789012345678",
+		"-1234567890123456789012345678901234567.8",
+		"1E+125",
+		"0.000000000000000000000000000000123",
+	} {
+		var lit, bound gocilib.Number
+		if err := conn.QueryRow("SELECT "+string(want)+", :1 FROM DUAL", want).Scan(&lit, &bound); err != nil {
+			t.Fatal(err)
+		}
+		w, _ := want.BigRat()
+		for _, got := range []gocilib.Number{lit, bound} {
+			if r, err := got.BigRat(); err != nil || r.Cmp(w) != 0 {
+				t.Errorf("got %q (%v), wanted %q", got, err, want)
+			}
+		}
+	}
+
+	// binding does not depend on the decimal separator of the session
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.ExecContext(ctx, "ALTER SESSION SET NLS_NUMERIC_CHARACTERS = ',.'"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.ExecContext(ctx, "ALTER SESSION SET NLS_NUMERIC_CHARACTERS = '.,'")
+	var eq int
+	if err = c.QueryRowContext(ctx, "SELECT CASE WHEN :1 = 1/8 THEN 1 ELSE 0 END FROM DUAL",
+		gocilib.Number("0.125")).Scan(&eq); err != nil {
+		t.Fatal(err)
+	}
+	if eq != 1 {
+		t.Errorf("0.125 is not bound as 1/8 with decimal comma")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	conn := getConnection(t)
+	var cur sql.Rows
+	if err := conn.QueryRow("SELECT CURSOR(SELECT LEVEL FROM DUAL CONNECT BY LEVEL <= 3) FROM DUAL").Scan(&cur); err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	var n, sum int
+	for cur.Next() {
+		if err := cur.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		sum += n
+	}
+	if err := cur.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 6 {
+		t.Errorf("got sum %d, wanted 6", sum)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	conn := getConnection(t)
+	_, err := conn.Exec("SELECT * FROM DUAL WHERE")
+	oraErr, ok := gocilib.AsError(err)
+	if !ok {
+		t.Fatalf("wanted *gocilib.Error, got %#v", err)
+	}
+	if oraErr.Type != gocilib.ErrOracle || oraErr.Offset <= 0 || oraErr.SQL == "" {
+		t.Errorf("wanted parse error with offset and SQL, got %#v", oraErr)
+	}
+
+	_, err = conn.Exec("BEGIN RAISE NO_DATA_FOUND; END;")
+	if oraErr, ok = gocilib.AsError(err); !ok || !errors.Is(oraErr, gocilib.ErrNoDataFound) {
+		t.Errorf("wanted ErrNoDataFound, got %v", err)
+	}
+	if gocilib.IsRetryable(err) {
+		t.Errorf("%v should not be retryable", err)
+	}
+}
+
+func TestConcurrentErrors(t *testing.T) {
+	conn := getConnection(t)
+	const goroutines, rounds = 16, 50
+	conn.SetMaxOpenConns(goroutines)
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(code int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				_, err := conn.Exec("BEGIN RAISE_APPLICATION_ERROR(:1, 'x'); END;", -code)
+				if oraErr, ok := gocilib.AsError(err); !ok || oraErr.Code != code {
+					errs <- fmt.Errorf("%d/%d. wanted ORA-%05d, got %v", code, j, code, err)
+					return
+				}
+				var n int
+				if err := conn.QueryRow("SELECT 1 FROM DUAL").Scan(&n); err != nil {
+					errs <- fmt.Errorf("%d/%d. got %v for a successful query", code, j, err)
+					return
+				}
+			}
+		}(20000 + i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type testTracer struct {
+	mu     sync.Mutex
+	events []gocilib.TraceEvent
+}
+
+func (t *testTracer) Trace(ev gocilib.TraceEvent) {
+	t.mu.Lock()
+	t.events = append(t.events, ev)
+	t.mu.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	flag.Parse()
+	cfg := ParseDSN(*fDsn)
+	var tr testTracer
+	cfg.Tracer = &tr
+	db := sql.OpenDB(NewConnector(cfg))
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var s string
+	if err = tx.QueryRow("SELECT :1 FROM DUAL", "a").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	seen := make(map[gocilib.TraceKind]gocilib.TraceEvent)
+	for _, ev := range tr.events {
+		seen[ev.Kind] = ev
+	}
+	for _, k := range []gocilib.TraceKind{
+		gocilib.TraceConnect, gocilib.TracePrepare, gocilib.TraceBind,
+		gocilib.TraceExecute, gocilib.TraceFetch, gocilib.TraceCommit,
+	} {
+		if _, ok := seen[k]; !ok {
+			t.Errorf("no %s event in %v", k, tr.events)
+		}
+	}
+	if ev := seen[gocilib.TraceExecute]; ev.SQL != "SELECT :1 FROM DUAL" || ev.BindCount != 1 {
+		t.Errorf("got %#v for execute", ev)
+	}
+	// QueryRow closes the rows after the first one, without reaching the end.
+	if ev := seen[gocilib.TraceFetch]; ev.SQL != "SELECT :1 FROM DUAL" || ev.Rows != 1 || ev.Err != nil {
+		t.Errorf("got %#v for fetch", ev)
+	}
+}
+
+func TestSlogTracerRedact(t *testing.T) {
+	flag.Parse()
+	cfg := ParseDSN(*fDsn)
+	var buf bytes.Buffer
+	cfg.Tracer = gocilib.SlogTracer{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+	db := sql.OpenDB(NewConnector(cfg))
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("SELECT :1 FROM DUAL", "s3cr3t").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, "type=string") {
+		t.Errorf("bind type not logged: %q", got)
+	}
+	if strings.Contains(got, "s3cr3t") {
+		t.Errorf("bind value logged: %q", got)
+	}
+}
+
+type testAddress struct {
+	Street string
+	Zip    int `oracle:"ZIP_CODE"`
+}
+
+type testPerson struct {
+	Name    string
+	Born    time.Time
+	Address *testAddress
+}
+
+func (testPerson) ObjectTypeName() string { return "GOCILIB_TEST_PERSON" }
+
+func (p *testPerson) Scan(src interface{}) error {
+	obj, ok := src.(*gocilib.Object)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into testPerson", src)
+	}
+	return obj.ToStruct(p)
+}
+
+func TestObject(t *testing.T) {
+	conn := getConnection(t)
+	for _, qry := range []string{
+		"CREATE OR REPLACE TYPE gocilib_test_address AS OBJECT (street VARCHAR2(40), zip_code NUMBER(5))",
+		"CREATE OR REPLACE TYPE gocilib_test_person AS OBJECT (name VARCHAR2(40), born DATE, address gocilib_test_address)",
+	} {
+		if _, err := conn.Exec(qry); err != nil {
+			t.Skipf("%s: %v", qry, err)
+		}
+	}
+	defer conn.Exec("DROP TYPE gocilib_test_person")
+	defer conn.Exec("DROP TYPE gocilib_test_address")
+
+	born := time.Date(1970, 1, 2, 3, 4, 5, 0, time.Local)
+	p := testPerson{Name: "Gopher", Born: born, Address: &testAddress{Street: "Main", Zip: 1234}}
+	if _, err := conn.Exec(`DECLARE
+  v gocilib_test_person := :1;
+BEGIN
+  v.name := UPPER(v.name); v.address.zip_code := v.address.zip_code + 1; :1 := v;
+END;`, sql.Out{Dest: &p, In: true}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "GOPHER" || p.Address == nil || p.Address.Zip != 1235 || !p.Born.Equal(born) {
+		t.Errorf("got %#v (%#v)", p, p.Address)
+	}
+
+	var q testPerson
+	if err := conn.QueryRow(`SELECT gocilib_test_person('Ken', NULL, gocilib_test_address('Bell', 7)) FROM DUAL`).Scan(&q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "Ken" || !q.Born.IsZero() || q.Address == nil || q.Address.Street != "Bell" || q.Address.Zip != 7 {
+		t.Errorf("got %#v (%#v)", q, q.Address)
+	}
+}
+
+type testAddresses []testAddress
+
+func (testAddresses) ObjectTypeName() string { return "GOCILIB_TEST_ADDRESSES" }
+
+func (a *testAddresses) Scan(src interface{}) error {
+	co, ok := src.(*gocilib.Coll)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into testAddresses", src)
+	}
+	return co.ToSlice(a)
+}
+
+func TestCollection(t *testing.T) {
+	conn := getConnection(t)
+	var sum int64
+	if err := conn.QueryRow(
+		"SELECT SUM(column_value) FROM TABLE(:1) WHERE column_value IN (SELECT column_value FROM TABLE(:2))",
+		[]int64{1, 2, 3, 4}, []int64{2, 4, 8},
+	).Scan(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 6 {
+		t.Errorf("got sum %d, wanted 6", sum)
+	}
+
+	for _, qry := range []string{
+		"CREATE OR REPLACE TYPE gocilib_test_address AS OBJECT (street VARCHAR2(40), zip_code NUMBER(5))",
+		"CREATE OR REPLACE TYPE gocilib_test_addresses AS TABLE OF gocilib_test_address",
+	} {
+		if _, err := conn.Exec(qry); err != nil {
+			t.Skipf("%s: %v", qry, err)
+		}
+	}
+	defer conn.Exec("DROP TYPE gocilib_test_address")
+	defer conn.Exec("DROP TYPE gocilib_test_addresses")
+
+	addrs := testAddresses{{Street: "a", Zip: 1}, {Street: "b", Zip: 2}}
+	if _, err := conn.Exec(`DECLARE
+  v gocilib_test_addresses := :1;
+BEGIN
+  v.EXTEND; v(v.LAST) := gocilib_test_address('c', v.COUNT); :1 := v;
+END;`, sql.Out{Dest: &addrs, In: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 3 || addrs[2].Street != "c" || addrs[2].Zip != 3 {
+		t.Errorf("got %#v", addrs)
+	}
+
+	var got testAddresses
+	if err := conn.QueryRow(
+		"SELECT gocilib_test_addresses(gocilib_test_address('x', 9)) FROM DUAL",
+	).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != (testAddress{Street: "x", Zip: 9}) {
+		t.Errorf("got %#v", got)
+	}
+}
+
+type testNumbers []gocilib.Number
+
+func (a *testNumbers) Scan(src interface{}) error {
+	co, ok := src.(*gocilib.Coll)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into testNumbers", src)
+	}
+	return co.ToSlice(a)
+}
+
+func TestCollectionNumber(t *testing.T) {
+	conn := getConnection(t)
+	want := []gocilib.Number{
+		"12345678901234567890123456789012345678",
+		"-1234567890123456789012345678901234567.8",
+		"1E+125",
+		"0.000000000000000000000000000000123",
+	}
+	lits := make([]string, len(want))
+	for i, n := range want {
+		lits[i] = string(n)
+	}
+	list := strings.Join(lits, ", ")
+
+	var got testNumbers
+	if err := conn.QueryRow("SELECT SYS.ODCINUMBERLIST(" + list + ") FROM DUAL").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, wanted %q", got, want)
+	}
+	for i, n := range got {
+		r, err := n.BigRat()
+		w, _ := want[i].BigRat()
+		if err != nil || r.Cmp(w) != 0 {
+			t.Errorf("%d. got %q (%v), wanted %q", i, n, err, want[i])
+		}
+	}
+
+	// the elements are set exactly, too
+	var n int
+	if err := conn.QueryRow(
+		"SELECT COUNT(0) FROM TABLE(:1) WHERE column_value IN ("+list+")", want,
+	).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(want) {
+		t.Errorf("%d of %d elements are bound exactly", n, len(want))
+	}
+}
+
+func TestListDML(t *testing.T) {
+	conn := getConnection(t)
+	conn.Exec("DROP TABLE tst_gocilib_list")
+	if _, err := conn.Exec("CREATE TABLE tst_gocilib_list (id NUMBER(3))"); err != nil {
+		t.Skipf("cannot create table: %v", err)
+	}
+	defer conn.Exec("DROP TABLE tst_gocilib_list")
+	if _, err := conn.Exec("INSERT INTO tst_gocilib_list (id) SELECT LEVEL FROM DUAL CONNECT BY LEVEL <= 5"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := conn.Exec(
+		"DELETE FROM tst_gocilib_list WHERE id IN (SELECT column_value FROM TABLE(:1))",
+		gocilib.List([]int64{2, 4, 8}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 2 {
+		t.Errorf("deleted %d rows (%v), wanted 2", n, err)
+	}
+	var n int
+	if err = conn.QueryRow("SELECT COUNT(0) FROM tst_gocilib_list").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("%d rows remained, wanted 3", n)
+	}
+}
+
+func TestPLSQLArray(t *testing.T) {
+	conn := getConnection(t)
+	for _, qry := range []string{
+		`CREATE OR REPLACE PACKAGE gocilib_test_pkg AS
+  TYPE num_tab IS TABLE OF NUMBER INDEX BY PLS_INTEGER;
+  TYPE str_tab IS TABLE OF VARCHAR2(100) INDEX BY PLS_INTEGER;
+  PROCEDURE double_it(p_in IN num_tab, p_out OUT str_tab, p_io IN OUT num_tab);
+END;`,
+		`CREATE OR REPLACE PACKAGE BODY gocilib_test_pkg AS
+  PROCEDURE double_it(p_in IN num_tab, p_out OUT str_tab, p_io IN OUT num_tab) IS
+  BEGIN
+    FOR i IN 1..p_in.COUNT LOOP
+      p_out(i) := TO_CHAR(2 * p_in(i));
+    END LOOP;
+    p_io(p_io.COUNT + 1) := p_io.COUNT + 1;
+  END;
+END;`,
+	} {
+		if _, err := conn.Exec(qry); err != nil {
+			t.Skipf("%s: %v", qry, err)
+		}
+	}
+	defer conn.Exec("DROP PACKAGE gocilib_test_pkg")
+
+	var strs []string
+	io := []int64{1}
+	if _, err := conn.Exec("BEGIN gocilib_test_pkg.double_it(:1, :2, :3); END;",
+		gocilib.PLSQLArray{Dest: []int64{1, 2, 3}},
+		gocilib.PLSQLArray{Dest: &strs, MaxLen: 10, Size: 100},
+		gocilib.PLSQLArray{Dest: &io, In: true, MaxLen: 10},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(strs, ","); got != "2,4,6" {
+		t.Errorf("got %q, wanted 2,4,6", got)
+	}
+	if len(io) != 2 || io[1] != 2 {
+		t.Errorf("got %v, wanted [1 2]", io)
+	}
+
+	uio := []uint64{1}
+	if _, err := conn.Exec("BEGIN gocilib_test_pkg.double_it(:1, :2, :3); END;",
+		gocilib.PLSQLArray{Dest: []uint64{1 << 63}},
+		gocilib.PLSQLArray{Dest: &strs, MaxLen: 10, Size: 100},
+		gocilib.PLSQLArray{Dest: &uio, In: true, MaxLen: 10},
+	); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("wanted overflow error, got %v", err)
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	conn := getConnection(t)
+	loc, err := time.LoadLocation("Europe/Budapest")
+	if err != nil {
+		t.Skip(err)
+	}
+	want := time.Date(2014, 3, 4, 5, 6, 7, 123456789, loc)
+	var got time.Time
+	var region string
+	if err = conn.QueryRow(
+		"SELECT CAST(:1 AS TIMESTAMP(9) WITH TIME ZONE), TO_CHAR(:1, 'TZR') FROM DUAL", want,
+	).Scan(&got, &region); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) || got.Nanosecond() != want.Nanosecond() {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+	if region != loc.String() || got.Location().String() != loc.String() {
+		t.Errorf("got region %q (%s), wanted %s", region, got.Location(), loc)
+	}
+
+	if err = conn.QueryRow("SELECT :1 FROM DUAL",
+		gocilib.TimeAs{Time: want, Type: gocilib.TimeDate},
+	).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Nanosecond() != 0 {
+		t.Errorf("DATE bind kept the fractional seconds: %s", got)
+	}
+}
+
+func TestInterval(t *testing.T) {
+	conn := getConnection(t)
+	var (
+		ym, ymIn gocilib.YearMonthInterval
+		ds, dsIn gocilib.DaySecondInterval
+	)
+	if err := conn.QueryRow(`SELECT INTERVAL '1-2' YEAR TO MONTH,
+	  INTERVAL '3 04:05:06.123456789' DAY TO SECOND(9), :1, :2 FROM DUAL`,
+		gocilib.YearMonthInterval{Years: -2, Months: -3},
+		gocilib.DaySecondInterval{Days: 100000000, Nanoseconds: 5},
+	).Scan(&ym, &ds, &ymIn, &dsIn); err != nil {
+		t.Fatal(err)
+	}
+	if ym != (gocilib.YearMonthInterval{Years: 1, Months: 2}) {
+		t.Errorf("got %#v, wanted 1-2", ym)
+	}
+	if want := (gocilib.DaySecondInterval{Days: 3, Hours: 4, Minutes: 5, Seconds: 6, Nanoseconds: 123456789}); ds != want {
+		t.Errorf("got %#v, wanted %#v", ds, want)
+	}
+	if ymIn != (gocilib.YearMonthInterval{Years: -2, Months: -3}) {
+		t.Errorf("got %#v, wanted -2-3", ymIn)
+	}
+	if dsIn != (gocilib.DaySecondInterval{Days: 100000000, Nanoseconds: 5}) {
+		t.Errorf("got %#v, wanted 100000000 days and 5ns", dsIn)
+	}
+
+	if s := ym.String(); s != "+01-02" {
+		t.Errorf("got %q, wanted +01-02", s)
+	}
+	if got, err := gocilib.ParseDaySecondInterval(ds.String()); err != nil || got != ds {
+		t.Errorf("round-trip of %s: got %#v (%v)", ds, got, err)
+	}
+
+	jan31 := time.Date(2014, 1, 31, 12, 0, 0, 0, time.UTC)
+	if _, err := (gocilib.YearMonthInterval{Months: 1}).AddTo(jan31); err == nil {
+		t.Errorf("%s + 1 month should be invalid, as ORA-01839", jan31)
+	}
+	if got, err := (gocilib.YearMonthInterval{Years: 1, Months: 2}).AddTo(jan31); err != nil || !got.Equal(time.Date(2015, 3, 31, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %s (%v), wanted 2015-03-31", got, err)
+	}
+	if got := ds.AddTo(jan31); !got.Equal(time.Date(2014, 2, 3, 16, 5, 6, 123456789, time.UTC)) {
+		t.Errorf("got %s, wanted 2014-02-03T16:05:06.123456789", got)
+	}
+}
+
+func TestPreparedOut(t *testing.T) {
+	conn := getConnection(t)
+	st, err := conn.Prepare("BEGIN :1 := :2 * 2; END;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	var first, second int64
+	if _, err = st.Exec(sql.Out{Dest: &first}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = st.Exec(sql.Out{Dest: &second}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if first != 2 || second != 4 {
+		t.Errorf("got %d, %d, wanted 2, 4", first, second)
+	}
+}
+
+func TestImplicitResults(t *testing.T) {
+	conn := getConnection(t)
+	rows, err := conn.Query(`DECLARE c SYS_REFCURSOR;
+BEGIN
+  OPEN c FOR SELECT 1 FROM DUAL;
+  DBMS_SQL.RETURN_RESULT(c);
+  OPEN c FOR SELECT 2, 'b' FROM DUAL UNION ALL SELECT 3, 'c' FROM DUAL;
+  DBMS_SQL.RETURN_RESULT(c);
+END;`)
+	if err != nil {
+		t.Skipf("no implicit results (before 12c?): %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	var got []int
+	for rows.NextResultSet() {
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := make([]interface{}, len(cols))
+		var n int
+		dest[0] = &n
+		for i := 1; i < len(dest); i++ {
+			dest[i] = new(string)
+		}
+		for rows.Next() {
+			if err = rows.Scan(dest...); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("got %v, wanted [1 2 3]", got)
+	}
+}
+
 var testDB *sql.DB
 
 func getConnection(t *testing.T) *sql.DB {
@@ -0,0 +1,231 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrorType is the source of an Error.
+type ErrorType uint8
+
+const (
+	// ErrOracle is an error returned by the Oracle client or server (ORA-xxxxx).
+	ErrOracle = ErrorType(C.OCI_ERR_ORACLE)
+	// ErrOCILIB is an error raised by OCILIB itself.
+	ErrOCILIB = ErrorType(C.OCI_ERR_OCILIB)
+	// ErrWarning is an Oracle warning.
+	ErrWarning = ErrorType(C.OCI_ERR_WARNING)
+)
+
+func (t ErrorType) String() string {
+	switch t {
+	case ErrOracle:
+		return "Oracle"
+	case ErrOCILIB:
+		return "OCILIB"
+	case ErrWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("ErrorType(%d)", t)
+}
+
+// Error is an Oracle or OCILIB error.
+//
+// errors.Is reports whether an Error matches one of the ErrNoDataFound,
+// ErrUniqueViolation, ErrDeadlock, ErrTimeout or ErrConnLost classes.
+type Error struct {
+	// Code is the ORA error code, -1 for OCILIB errors (of Type ErrOCILIB),
+	// so it is never 0.
+	Code int
+	Text string
+	Type ErrorType
+	// Offset is the position (in characters, starting at 0) of the error in SQL,
+	// as reported by Oracle: 0 also for the errors without a position.
+	// It is -1 if there is no SQL.
+	Offset int
+	// Row is the index (starting at 1) of the row causing the error in an array DML,
+	// 0 if the error is not related to array DML.
+	Row int
+	// SQL is the statement causing the error, if any.
+	SQL string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Text)
+}
+
+// Is reports whether target is the class of the error's ORA code.
+func (e Error) Is(target error) bool {
+	return target != nil && oraCodes[e.Code] == target
+}
+
+var (
+	// ErrNoDataFound is ORA-01403.
+	ErrNoDataFound = errors.New("no data found")
+	// ErrUniqueViolation is ORA-00001.
+	ErrUniqueViolation = errors.New("unique constraint violated")
+	// ErrDeadlock is ORA-00060.
+	ErrDeadlock = errors.New("deadlock detected")
+	// ErrTimeout is the class of the lock, resource and call timeout errors.
+	ErrTimeout = errors.New("timeout")
+	// ErrConnLost is the class of the errors after which the connection is unusable.
+	ErrConnLost = errors.New("connection lost")
+)
+
+// oraCodes classifies the ORA error codes.
+var oraCodes = map[int]error{
+	1:    ErrUniqueViolation,
+	60:   ErrDeadlock,
+	1403: ErrNoDataFound,
+
+	51:    ErrTimeout, // timeout occurred while waiting for a resource
+	2049:  ErrTimeout, // timeout: distributed transaction waiting for lock
+	3156:  ErrTimeout, // OCI call timed out
+	4021:  ErrTimeout, // timeout occurred while waiting to lock object
+	12535: ErrTimeout, // TNS:operation timed out
+	30006: ErrTimeout, // resource busy; acquire with WAIT timeout expired
+
+	115:   ErrConnLost,
+	451:   ErrConnLost,
+	452:   ErrConnLost,
+	609:   ErrConnLost,
+	1073:  ErrConnLost,
+	1090:  ErrConnLost,
+	1092:  ErrConnLost,
+	3113:  ErrConnLost,
+	3114:  ErrConnLost,
+	3135:  ErrConnLost,
+	3136:  ErrConnLost,
+	12153: ErrConnLost,
+	12161: ErrConnLost,
+	12170: ErrConnLost,
+	12224: ErrConnLost,
+	12230: ErrConnLost,
+	12233: ErrConnLost,
+	12510: ErrConnLost,
+	12511: ErrConnLost,
+	12514: ErrConnLost,
+	12518: ErrConnLost,
+	12526: ErrConnLost,
+	12527: ErrConnLost,
+	12528: ErrConnLost,
+	12539: ErrConnLost,
+}
+
+// retryableCodes are the ORA error codes without a class, after which
+// the transaction can be retried.
+var retryableCodes = map[int]bool{
+	54:   true, // resource busy and acquire with NOWAIT specified
+	8176: true, // consistent read failure; rollback data not available
+	8177: true, // can't serialize access for this transaction
+}
+
+// AsError returns the *Error in err's chain, following Unwrap (also of the
+// errors wrapping more than one, such as a broken call's, see Statement.watchContext)
+// and the Underlying method of errgo's errors.
+func AsError(err error) (*Error, bool) {
+	for err != nil {
+		switch x := err.(type) {
+		case *Error:
+			return x, true
+		case Error:
+			return &x, true
+		case interface{ Underlying() error }:
+			err = x.Underlying()
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				if oraErr, ok := AsError(e); ok {
+					return oraErr, true
+				}
+			}
+			return nil, false
+		default:
+			err = errors.Unwrap(err)
+		}
+	}
+	return nil, false
+}
+
+// IsRetryable reports whether the operation which returned err can be retried:
+// the error is a deadlock, a timeout, a lost connection or a serialization failure.
+func IsRetryable(err error) bool {
+	e, ok := AsError(err)
+	if !ok {
+		return false
+	}
+	switch oraCodes[e.Code] {
+	case ErrDeadlock, ErrTimeout, ErrConnLost:
+		return true
+	}
+	return retryableCodes[e.Code]
+}
+
+// IsConnLost reports whether err means the connection is unusable.
+func IsConnLost(err error) bool {
+	e, ok := AsError(err)
+	return ok && oraCodes[e.Code] == ErrConnLost
+}
+
+// getLastErr returns the last error raised by OCILIB on the current OS thread.
+//
+// As OCILIB keeps the last error per thread, the failing call and getLastErr
+// must run on the same thread: the callers lock the goroutine to its thread with
+// runtime.LockOSThread, as the goroutine could migrate between the two calls.
+func getLastErr() error {
+	ociErr := C.OCI_GetLastError()
+	if ociErr == nil {
+		return nil
+	}
+	return ociErrToErr(ociErr)
+}
+
+// ociErrToErr converts the OCI_Error to an *Error.
+func ociErrToErr(ociErr *C.OCI_Error) *Error {
+	code := int(C.OCI_ErrorGetOCICode(ociErr))
+	if code == 0 {
+		code = -1
+	}
+	e := Error{
+		Code:   code,
+		Text:   C.GoString(C.OCI_ErrorGetString(ociErr)),
+		Type:   ErrorType(C.OCI_ErrorGetType(ociErr)),
+		Offset: -1,
+		Row:    int(C.OCI_ErrorGetRow(ociErr)),
+	}
+	if st := C.OCI_ErrorGetStatement(ociErr); st != nil {
+		if sql := C.OCI_GetSql(st); sql != nil {
+			e.SQL = C.GoString(sql)
+			e.Offset = charOffset(e.SQL, int(C.OCI_GetSqlErrorPos(st)))
+		}
+	}
+	return &e
+}
+
+// charOffset converts the byte offset of OCI_ATTR_PARSE_ERROR_OFFSET
+// to a character offset in sql.
+func charOffset(sql string, offset int) int {
+	if offset > len(sql) {
+		offset = len(sql)
+	}
+	return utf8.RuneCountInString(sql[:offset])
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCharOffset(t *testing.T) {
+	for i, tc := range []struct {
+		sql           string
+		offset, chars int
+	}{
+		{"SELECT * FROM DUAL WHERE", 0, 0},
+		{"SELECT * FROM DUAL WHERE", 24, 24},
+		{"SELECT 'árvíztűrő' FROM DUAL WHERE", 38, 34},
+		{"SELECT", 10, 6},
+	} {
+		if got := charOffset(tc.sql, tc.offset); got != tc.chars {
+			t.Errorf("%d. charOffset(%q, %d): got %d, wanted %d.", i, tc.sql, tc.offset, got, tc.chars)
+		}
+	}
+}
+
+func TestIsConnLost(t *testing.T) {
+	lost, other := &Error{Code: 3113}, &Error{Code: 1013}
+	for i, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{lost, true},
+		{other, false},
+		{fmt.Errorf("wrapped: %w", lost), true},
+		// as returned by a broken call
+		{fmt.Errorf("%w: %w", context.Canceled, lost), true},
+		{fmt.Errorf("%w: %w", context.Canceled, other), false},
+		{context.Canceled, false},
+	} {
+		if got := IsConnLost(tc.err); got != tc.want {
+			t.Errorf("%d. IsConnLost(%v): got %t, wanted %t.", i, tc.err, got, tc.want)
+		}
+	}
+}
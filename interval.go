@@ -0,0 +1,392 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// YearMonthInterval is an INTERVAL YEAR TO MONTH.
+// The fields of a negative interval are both zero or negative.
+//
+// FetchInto returns the YEAR TO MONTH intervals as YearMonthInterval,
+// and BindName accepts it.
+type YearMonthInterval struct {
+	Years, Months int
+}
+
+// DaySecondInterval is an INTERVAL DAY TO SECOND, without the range limit
+// of time.Duration. The fields of a negative interval are all zero or negative.
+//
+// FetchInto returns the DAY TO SECOND intervals as time.Duration,
+// or as DaySecondInterval for *DaySecondInterval destinations and for the
+// intervals out of the range of time.Duration. BindName accepts both.
+type DaySecondInterval struct {
+	Days, Hours, Minutes, Seconds, Nanoseconds int
+}
+
+// DaySecondIntervalFromDuration returns d as a DaySecondInterval.
+func DaySecondIntervalFromDuration(d time.Duration) DaySecondInterval {
+	var ds DaySecondInterval
+	ns := int64(d)
+	ds.Days = int(ns / int64(24*time.Hour))
+	ns -= int64(ds.Days) * int64(24*time.Hour)
+	ds.Hours = int(ns / int64(time.Hour))
+	ns -= int64(ds.Hours) * int64(time.Hour)
+	ds.Minutes = int(ns / int64(time.Minute))
+	ns -= int64(ds.Minutes) * int64(time.Minute)
+	ds.Seconds = int(ns / int64(time.Second))
+	ds.Nanoseconds = int(ns - int64(ds.Seconds)*int64(time.Second))
+	return ds
+}
+
+// Duration returns the interval as time.Duration, or an error if it is out of its range.
+func (ds DaySecondInterval) Duration() (time.Duration, error) {
+	f := ((float64(ds.Days)*24+float64(ds.Hours))*60+float64(ds.Minutes))*60 + float64(ds.Seconds)
+	if math.Abs(f) >= math.MaxInt64/float64(time.Second)-1 {
+		return 0, fmt.Errorf("%s overflows time.Duration", ds)
+	}
+	return time.Duration(ds.Days)*24*time.Hour + time.Duration(ds.Hours)*time.Hour +
+		time.Duration(ds.Minutes)*time.Minute + time.Duration(ds.Seconds)*time.Second +
+		time.Duration(ds.Nanoseconds), nil
+}
+
+// AddTo returns t+ym the way Oracle adds intervals to datetimes: the day of
+// month does not change, and it is an error (ORA-01839) if it does not exist
+// in the resulting month, unlike with time.Time.AddDate.
+//
+// As the DATE and TIMESTAMP values are fetched in time.Local, the others are
+// TIMESTAMP WITH TIME ZONE values: these are calculated in UTC, as Oracle does.
+func (ym YearMonthInterval) AddTo(t time.Time) (time.Time, error) {
+	loc := t.Location()
+	if loc != time.Local {
+		t = t.UTC()
+	}
+	y, m, d := t.Date()
+	months := y*12 + int(m) - 1 + ym.Years*12 + ym.Months
+	y, m = months/12, time.Month(months%12+1)
+	if months < 0 && months%12 != 0 {
+		y, m = y-1, m+12
+	}
+	if last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day(); d > last {
+		return t, fmt.Errorf("%s + %s: date not valid for month specified", t.Format("2006-01-02"), ym)
+	}
+	H, M, S := t.Clock()
+	return time.Date(y, m, d, H, M, S, t.Nanosecond(), t.Location()).In(loc), nil
+}
+
+// AddTo returns t+ds the way Oracle adds intervals to datetimes.
+//
+// As the DATE and TIMESTAMP values are fetched in time.Local, these
+// are calculated on the wall clock; the others are TIMESTAMP WITH TIME ZONE
+// values: these are calculated in UTC (a day is 24 hours), as Oracle does.
+func (ds DaySecondInterval) AddTo(t time.Time) time.Time {
+	loc := t.Location()
+	if loc != time.Local {
+		t = t.UTC()
+	}
+	y, m, d := t.Date()
+	H, M, S := t.Clock()
+	return time.Date(y, m, d+ds.Days, H+ds.Hours, M+ds.Minutes, S+ds.Seconds,
+		t.Nanosecond()+ds.Nanoseconds, t.Location()).In(loc)
+}
+
+// String returns the interval in Oracle's format, such as +01-02.
+func (ym YearMonthInterval) String() string {
+	if b, err := ym.MarshalText(); err == nil {
+		return string(b)
+	}
+	sign, y, m := '+', ym.Years, ym.Months
+	if y < 0 || m < 0 {
+		sign, y, m = '-', -y, -m
+	}
+	return fmt.Sprintf("%c%02d-%02d", sign, y, m)
+}
+
+// String returns the interval in Oracle's format, such as +01 02:03:04.000000005.
+func (ds DaySecondInterval) String() string {
+	if b, err := ds.MarshalText(); err == nil {
+		return string(b)
+	}
+	sign, d, H, M, S, F := '+', ds.Days, ds.Hours, ds.Minutes, ds.Seconds, ds.Nanoseconds
+	if d < 0 || H < 0 || M < 0 || S < 0 || F < 0 {
+		sign, d, H, M, S, F = '-', -d, -H, -M, -S, -F
+	}
+	return fmt.Sprintf("%c%02d %02d:%02d:%02d.%09d", sign, d, H, M, S, F)
+}
+
+// MarshalText returns the interval in Oracle's format, with OCI_IntervalToText.
+func (ym YearMonthInterval) MarshalText() ([]byte, error) {
+	return intervalToText(C.OCI_INTERVAL_YM, ym, leadingPrecision(ym.Years))
+}
+
+// MarshalText returns the interval in Oracle's format, with OCI_IntervalToText.
+func (ds DaySecondInterval) MarshalText() ([]byte, error) {
+	return intervalToText(C.OCI_INTERVAL_DS, ds, leadingPrecision(ds.Days))
+}
+
+// UnmarshalText parses the interval from Oracle's format (such as 1-2), with OCI_IntervalFromText.
+func (ym *YearMonthInterval) UnmarshalText(text []byte) error {
+	v, err := intervalFromText(C.OCI_INTERVAL_YM, text)
+	if err != nil {
+		return err
+	}
+	*ym = v.(YearMonthInterval)
+	return nil
+}
+
+// UnmarshalText parses the interval from Oracle's format (such as 1 2:3:4.5),
+// with OCI_IntervalFromText.
+func (ds *DaySecondInterval) UnmarshalText(text []byte) error {
+	v, err := intervalFromText(C.OCI_INTERVAL_DS, text)
+	if err != nil {
+		return err
+	}
+	*ds = v.(DaySecondInterval)
+	return nil
+}
+
+// ParseYearMonthInterval parses s in Oracle's format, such as 1-2 or -3-0.
+func ParseYearMonthInterval(s string) (YearMonthInterval, error) {
+	var ym YearMonthInterval
+	err := ym.UnmarshalText([]byte(s))
+	return ym, err
+}
+
+// ParseDaySecondInterval parses s in Oracle's format, such as 1 2:3:4.5.
+func ParseDaySecondInterval(s string) (DaySecondInterval, error) {
+	var ds DaySecondInterval
+	err := ds.UnmarshalText([]byte(s))
+	return ds, err
+}
+
+// Scan implements sql.Scanner.
+func (ym *YearMonthInterval) Scan(src interface{}) error {
+	switch x := src.(type) {
+	case nil:
+		*ym = YearMonthInterval{}
+	case YearMonthInterval:
+		*ym = x
+	case string:
+		return ym.UnmarshalText([]byte(x))
+	case []byte:
+		return ym.UnmarshalText(x)
+	default:
+		return fmt.Errorf("cannot scan %T into YearMonthInterval", src)
+	}
+	return nil
+}
+
+// Scan implements sql.Scanner.
+func (ds *DaySecondInterval) Scan(src interface{}) error {
+	switch x := src.(type) {
+	case nil:
+		*ds = DaySecondInterval{}
+	case DaySecondInterval:
+		*ds = x
+	case time.Duration:
+		*ds = DaySecondIntervalFromDuration(x)
+	case string:
+		return ds.UnmarshalText([]byte(x))
+	case []byte:
+		return ds.UnmarshalText(x)
+	default:
+		return fmt.Errorf("cannot scan %T into DaySecondInterval", src)
+	}
+	return nil
+}
+
+// leadingPrecision returns the number of digits of n, at least 2.
+func leadingPrecision(n int) int {
+	if n < 0 {
+		n = -n
+	}
+	if p := len(strconv.Itoa(n)); p > 2 {
+		return p
+	}
+	return 2
+}
+
+func intervalToText(typ C.uint, value interface{}, leadingPrec int) ([]byte, error) {
+	initialize()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	oi, err := newOCIInterval(nil, typ, value)
+	if err != nil {
+		return nil, err
+	}
+	defer C.OCI_IntervalFree(oi)
+	b := make([]byte, 64)
+	if C.OCI_IntervalToText(oi, C.int(leadingPrec), 9, C.int(len(b)), (*C.mtext)(unsafe.Pointer(&b[0]))) != C.TRUE {
+		return nil, getLastErr()
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return b, nil
+}
+
+func intervalFromText(typ C.uint, text []byte) (interface{}, error) {
+	initialize()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	oi := C.OCI_IntervalCreate(nil, typ)
+	if oi == nil {
+		return nil, getLastErr()
+	}
+	defer C.OCI_IntervalFree(oi)
+	s := C.CString(string(text))
+	defer C.free(unsafe.Pointer(s))
+	if C.OCI_IntervalFromText(oi, (*C.mtext)(unsafe.Pointer(s))) != C.TRUE {
+		return nil, fmt.Errorf("%q: %v", text, getLastErr())
+	}
+	if typ == C.OCI_INTERVAL_YM {
+		return ociIntervalToYearMonth(oi)
+	}
+	return ociIntervalToDaySecond(oi)
+}
+
+// newOCIInterval returns a new OCI_Interval of the given type set to value:
+// a YearMonthInterval for OCI_INTERVAL_YM, a DaySecondInterval or time.Duration
+// for OCI_INTERVAL_DS. It must be freed with OCI_IntervalFree.
+func newOCIInterval(con *C.OCI_Connection, typ C.uint, value interface{}) (*C.OCI_Interval, error) {
+	oi := C.OCI_IntervalCreate(con, typ)
+	if oi == nil {
+		return nil, getLastErr()
+	}
+	if err := setOCIInterval(oi, typ, value); err != nil {
+		C.OCI_IntervalFree(oi)
+		return nil, err
+	}
+	return oi, nil
+}
+
+// setOCIInterval sets the OCI_Interval of the given type to value.
+func setOCIInterval(oi *C.OCI_Interval, typ C.uint, value interface{}) error {
+	ok := C.int(C.FALSE)
+	switch x := value.(type) {
+	case YearMonthInterval:
+		if typ != C.OCI_INTERVAL_YM {
+			return fmt.Errorf("cannot set %T as INTERVAL DAY TO SECOND", value)
+		}
+		ok = C.OCI_IntervalSetYearMonth(oi, C.int(x.Years), C.int(x.Months))
+	case time.Duration:
+		return setOCIInterval(oi, typ, DaySecondIntervalFromDuration(x))
+	case DaySecondInterval:
+		if typ != C.OCI_INTERVAL_DS {
+			return fmt.Errorf("cannot set %T as INTERVAL YEAR TO MONTH", value)
+		}
+		ok = C.OCI_IntervalSetDaySecond(oi, C.int(x.Days), C.int(x.Hours), C.int(x.Minutes),
+			C.int(x.Seconds), C.int(x.Nanoseconds))
+	default:
+		return fmt.Errorf("cannot set %T as INTERVAL", value)
+	}
+	if ok != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// intervalType returns the OCI_INTERVAL_* type of the interval value.
+func intervalType(value interface{}) C.uint {
+	if _, ok := value.(YearMonthInterval); ok {
+		return C.OCI_INTERVAL_YM
+	}
+	return C.OCI_INTERVAL_DS
+}
+
+// bindInterval binds a YearMonthInterval, DaySecondInterval or time.Duration.
+func (stmt *Statement) bindInterval(name string, value interface{}) error {
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	oi, err := newOCIInterval(C.OCI_StatementGetConnection(h), intervalType(value), value)
+	if err != nil {
+		return fmt.Errorf("BindName(%s): %v", name, err)
+	}
+	stmt.frees = append(stmt.frees, func() { C.OCI_IntervalFree(oi) })
+	if C.OCI_BindInterval(h, nm, oi) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	return nil
+}
+
+// bindIntervals binds the n intervals returned by get as an array.
+func (stmt *Statement) bindIntervals(name string, n int, get func(i int) interface{}) error {
+	if n == 0 {
+		return fmt.Errorf("BindName(%s): empty interval slice", name)
+	}
+	typ := intervalType(get(0))
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	arr := C.OCI_IntervalArrayCreate(C.OCI_StatementGetConnection(h), typ, C.uint(n))
+	if arr == nil {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	stmt.frees = append(stmt.frees, func() { C.OCI_IntervalArrayFree(arr) })
+	for i, oi := range unsafe.Slice(arr, n) {
+		if err := setOCIInterval(oi, typ, get(i)); err != nil {
+			return fmt.Errorf("BindName(%s): %d. %v", name, i, err)
+		}
+	}
+	if C.OCI_BindArrayOfIntervals(h, nm, arr, typ, C.uint(n)) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	return nil
+}
+
+func ociIntervalToYearMonth(oi *C.OCI_Interval) (YearMonthInterval, error) {
+	var y, m C.int
+	if C.OCI_IntervalGetYearMonth(oi, &y, &m) != C.TRUE {
+		return YearMonthInterval{}, getLastErr()
+	}
+	return YearMonthInterval{Years: int(y), Months: int(m)}, nil
+}
+
+func ociIntervalToDaySecond(oi *C.OCI_Interval) (DaySecondInterval, error) {
+	var d, H, M, S, F C.int
+	if C.OCI_IntervalGetDaySecond(oi, &d, &H, &M, &S, &F) != C.TRUE {
+		return DaySecondInterval{}, getLastErr()
+	}
+	return DaySecondInterval{Days: int(d), Hours: int(H), Minutes: int(M), Seconds: int(S), Nanoseconds: int(F)}, nil
+}
+
+// ociIntervalValue returns the interval as a YearMonthInterval, or as a time.Duration
+// (as a DaySecondInterval if it does not fit).
+func ociIntervalValue(oi *C.OCI_Interval) (interface{}, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_IntervalGetType(oi) == C.OCI_INTERVAL_YM {
+		return ociIntervalToYearMonth(oi)
+	}
+	ds, err := ociIntervalToDaySecond(oi)
+	if err != nil {
+		return nil, err
+	}
+	if d, err := ds.Duration(); err == nil {
+		return d, nil
+	}
+	return ds, nil
+}
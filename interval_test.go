@@ -0,0 +1,122 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestYearMonthAddTo(t *testing.T) {
+	plus10 := time.FixedZone("", 10*3600)
+	for i, tc := range []struct {
+		ym      YearMonthInterval
+		t, want time.Time
+	}{
+		{YearMonthInterval{Months: 1},
+			time.Date(2014, 1, 15, 1, 2, 3, 4, time.Local), time.Date(2014, 2, 15, 1, 2, 3, 4, time.Local)},
+		{YearMonthInterval{Months: -2},
+			time.Date(2014, 1, 15, 0, 0, 0, 0, time.Local), time.Date(2013, 11, 15, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Years: -1, Months: -2},
+			time.Date(2014, 2, 28, 0, 0, 0, 0, time.Local), time.Date(2012, 12, 28, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Months: -12},
+			time.Date(2014, 12, 1, 0, 0, 0, 0, time.Local), time.Date(2013, 12, 1, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Years: 1, Months: 11},
+			time.Date(2014, 1, 31, 0, 0, 0, 0, time.Local), time.Date(2015, 12, 31, 0, 0, 0, 0, time.Local)},
+		// before year 0, the month count is negative
+		{YearMonthInterval{Months: -1},
+			time.Date(0, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(-1, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{YearMonthInterval{Months: -12},
+			time.Date(0, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(-1, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{YearMonthInterval{Years: -1, Months: -11},
+			time.Date(0, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(-2, 2, 15, 0, 0, 0, 0, time.UTC)},
+		// the zoned times are calculated in UTC
+		{YearMonthInterval{Months: 1},
+			time.Date(2014, 3, 1, 5, 0, 0, 0, plus10), time.Date(2014, 3, 29, 5, 0, 0, 0, plus10)},
+	} {
+		got, err := tc.ym.AddTo(tc.t)
+		if err != nil {
+			t.Errorf("%d. %v + %+v: %v", i, tc.t, tc.ym, err)
+			continue
+		}
+		if !got.Equal(tc.want) || got.Location() != tc.want.Location() {
+			t.Errorf("%d. %v + %+v: got %v, wanted %v.", i, tc.t, tc.ym, got, tc.want)
+		}
+	}
+
+	// ORA-01839: date not valid for month specified
+	for i, tc := range []struct {
+		ym YearMonthInterval
+		t  time.Time
+	}{
+		{YearMonthInterval{Months: 1}, time.Date(2014, 1, 31, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Months: -1}, time.Date(2014, 3, 31, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Years: 1}, time.Date(2012, 2, 29, 0, 0, 0, 0, time.Local)},
+		{YearMonthInterval{Months: -13}, time.Date(2014, 3, 31, 0, 0, 0, 0, time.Local)},
+		// 2014-02-01 05:00 +10:00 is 2014-01-31 19:00 UTC
+		{YearMonthInterval{Months: 1}, time.Date(2014, 2, 1, 5, 0, 0, 0, plus10)},
+	} {
+		if got, err := tc.ym.AddTo(tc.t); err == nil {
+			t.Errorf("%d. %v + %+v: got %v, wanted error.", i, tc.t, tc.ym, got)
+		}
+	}
+}
+
+func TestDaySecondAddTo(t *testing.T) {
+	ds := DaySecondInterval{Days: 1, Hours: -1, Nanoseconds: 5}
+	t0 := time.Date(2014, 12, 31, 23, 30, 0, 0, time.Local)
+	if got, want := ds.AddTo(t0), time.Date(2015, 1, 1, 22, 30, 0, 5, time.Local); !got.Equal(want) {
+		t.Errorf("%v + %+v: got %v, wanted %v.", t0, ds, got, want)
+	}
+	ds = DaySecondInterval{Days: -1, Minutes: -30}
+	t0 = time.Date(2014, 3, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := ds.AddTo(t0), time.Date(2014, 2, 27, 23, 30, 0, 0, time.UTC); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("%v + %+v: got %v, wanted %v.", t0, ds, got, want)
+	}
+}
+
+func TestDaySecondDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		0,
+		time.Nanosecond,
+		-90 * time.Minute,
+		49*time.Hour + 2*time.Minute + 3*time.Second + 4,
+		-(49*time.Hour + 2*time.Minute + 3*time.Second + 4),
+		106751 * 24 * time.Hour,
+		-106751 * 24 * time.Hour,
+	} {
+		ds := DaySecondIntervalFromDuration(d)
+		if got, err := ds.Duration(); err != nil || got != d {
+			t.Errorf("%v: got %v (%v) from %+v.", d, got, err, ds)
+		}
+	}
+
+	if got, want := DaySecondIntervalFromDuration(-(25*time.Hour + 30*time.Second + 1)),
+		(DaySecondInterval{Days: -1, Hours: -1, Seconds: -30, Nanoseconds: -1}); got != want {
+		t.Errorf("got %+v, wanted %+v.", got, want)
+	}
+
+	for _, ds := range []DaySecondInterval{
+		{Days: 106752},
+		{Days: -106752},
+		{Days: 999999999, Hours: 23},
+	} {
+		if d, err := ds.Duration(); err == nil {
+			t.Errorf("%+v: got %v, wanted overflow error.", ds, d)
+		}
+	}
+}
@@ -16,48 +16,265 @@ limitations under the License.
 
 package gocilib
 
-// #cgo LDFLAGS: -locilib
 // #include "ocilib.h"
 import "C"
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// LobType is the type of a LOB.
+type LobType uint
+
+const (
+	BLOB  = LobType(C.OCI_BLOB)
+	CLOB  = LobType(C.OCI_CLOB)
+	NCLOB = LobType(C.OCI_NCLOB)
+)
+
+// minLobBufSize is the minimal size of the LOB read/write buffers.
+const minLobBufSize = 32 << 10
+
+// LOB is a BLOB, CLOB or NCLOB.
+// It implements io.Reader, io.Writer, io.Seeker and io.Closer, reading and
+// writing in multiples of the LOB's chunk size.
+//
+// For CLOBs and NCLOBs the offsets (Seek, Size, Truncate) are in characters,
+// for BLOBs they are in bytes.
+//
+// A LOB fetched by FetchInto is valid only till the next fetch.
 type LOB struct {
-	handle *C.OCI_Lob
+	handle    *C.OCI_Lob
+	temporary bool
+
+	// rbuf holds the read-ahead, wbuf the not yet written data
+	rbuf, wbuf []byte
+	bufSize    int
+}
+
+// NewLOB creates a new temporary LOB, which is freed on Close.
+func (conn *Connection) NewLOB(typ LobType) (*LOB, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	lob := LOB{handle: C.OCI_LobCreate(conn.handle, C.uint(typ)), temporary: true}
+	if lob.handle == nil {
+		return nil, getLastErr()
+	}
+	return &lob, nil
 }
 
 func (lo LOB) Type() C.uint {
 	return C.OCI_LobGetType(lo.handle)
 }
 
-type File struct {
-	handle *C.OCI_File
+func (lo *LOB) isBinary() bool {
+	return lo.Type() == C.OCI_BLOB
 }
 
-func (fi File) Type() C.uint {
-	return C.OCI_FileGetType(fi.handle)
+// bufferSize returns the size of the buffers: a multiple of the chunk size.
+func (lo *LOB) bufferSize() int {
+	if lo.bufSize == 0 {
+		chunk := int(C.OCI_LobGetChunkSize(lo.handle))
+		if chunk <= 0 {
+			chunk = 8192
+		}
+		lo.bufSize = ((minLobBufSize + chunk - 1) / chunk) * chunk
+	}
+	return lo.bufSize
 }
 
-type Object struct {
-	handle *C.OCI_Object
+// Read reads from the LOB at the current offset.
+func (lo *LOB) Read(p []byte) (int, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if lo.handle == nil {
+		return 0, errors.New("read of closed LOB")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(lo.wbuf) > 0 {
+		if err := lo.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(lo.rbuf) == 0 {
+		size := lo.bufferSize()
+		// OCILIB terminates the character LOBs with a zero
+		buf := make([]byte, size+4)
+		var charCount C.uint
+		byteCount := C.uint(size)
+		if C.OCI_LobRead2(lo.handle, unsafe.Pointer(&buf[0]), &charCount, &byteCount) != C.TRUE {
+			return 0, getLastErr()
+		}
+		if byteCount == 0 {
+			return 0, io.EOF
+		}
+		lo.rbuf = buf[:byteCount]
+	}
+	n := copy(p, lo.rbuf)
+	lo.rbuf = lo.rbuf[n:]
+	return n, nil
 }
 
-func (ob Object) Type() *C.OCI_TypeInfo {
-	return C.OCI_ObjectGetTypeInfo(ob.handle)
+// Write writes p into the LOB at the current offset.
+// The data is written in multiples of the chunk size, call Flush or Close
+// to write the remainder.
+func (lo *LOB) Write(p []byte) (int, error) {
+	if lo.handle == nil {
+		return 0, errors.New("write to closed LOB")
+	}
+	if len(lo.rbuf) > 0 {
+		if _, err := lo.Seek(0, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+	lo.wbuf = append(lo.wbuf, p...)
+	if size := lo.bufferSize(); len(lo.wbuf) >= size {
+		n := len(lo.wbuf) - len(lo.wbuf)%size
+		if err := lo.write(n); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
 }
 
-type Ref struct {
-	handle *C.OCI_Ref
+// Flush writes the buffered data into the LOB.
+func (lo *LOB) Flush() error {
+	if len(lo.wbuf) == 0 {
+		return nil
+	}
+	return lo.write(len(lo.wbuf))
 }
 
-func (re Ref) Type() *C.OCI_TypeInfo {
-	return C.OCI_RefGetTypeInfo(re.handle)
+// write writes the first n bytes of wbuf (for character LOBs, without
+// the trailing incomplete rune), and keeps the rest.
+func (lo *LOB) write(n int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var charCount C.uint
+	if !lo.isBinary() {
+		if i := lastRuneStart(lo.wbuf[:n]); i < n && !utf8.FullRune(lo.wbuf[i:n]) {
+			n = i
+		}
+		// OCILIB would count the characters till a terminating zero
+		charCount = C.uint(utf8.RuneCount(lo.wbuf[:n]))
+	}
+	if n == 0 {
+		return nil
+	}
+	byteCount := C.uint(n)
+	if C.OCI_LobWrite2(lo.handle, unsafe.Pointer(&lo.wbuf[0]), &charCount, &byteCount) != C.TRUE {
+		return getLastErr()
+	}
+	lo.wbuf = lo.wbuf[:copy(lo.wbuf, lo.wbuf[n:])]
+	return nil
 }
 
-type Coll struct {
-	handle *C.OCI_Coll
+// lastRuneStart returns the start index of the last rune in p.
+func lastRuneStart(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			return i
+		}
+	}
+	return len(p)
 }
 
-func (co Coll) Type() *C.OCI_TypeInfo {
-	return C.OCI_CollGetTypeInfo(co.handle)
+// Seek sets the offset for the next Read or Write.
+func (lo *LOB) Seek(offset int64, whence int) (int64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if lo.handle == nil {
+		return 0, errors.New("seek in closed LOB")
+	}
+	if err := lo.Flush(); err != nil {
+		return 0, err
+	}
+	// the read-ahead is not consumed yet
+	cur := int64(C.OCI_LobGetOffset(lo.handle))
+	if lo.isBinary() {
+		cur -= int64(len(lo.rbuf))
+	} else {
+		cur -= int64(utf8.RuneCount(lo.rbuf))
+	}
+	lo.rbuf = nil
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cur
+	case io.SeekEnd:
+		offset += int64(C.OCI_LobGetLength(lo.handle))
+	default:
+		return cur, fmt.Errorf("Seek: bad whence %d", whence)
+	}
+	if offset < 0 {
+		return cur, fmt.Errorf("Seek: negative offset %d", offset)
+	}
+	if C.OCI_LobSeek(lo.handle, C.big_uint(offset), C.OCI_SEEK_SET) != C.TRUE {
+		return cur, getLastErr()
+	}
+	return offset, nil
+}
+
+// Size returns the length of the LOB.
+func (lo *LOB) Size() (int64, error) {
+	if err := lo.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(C.OCI_LobGetLength(lo.handle)), nil
+}
+
+// Truncate truncates the LOB to the given size.
+func (lo *LOB) Truncate(size int64) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := lo.Flush(); err != nil {
+		return err
+	}
+	lo.rbuf = nil
+	if C.OCI_LobTruncate(lo.handle, C.big_uint(size)) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Close flushes the buffered data, and frees the LOB if it is temporary.
+func (lo *LOB) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if lo.handle == nil {
+		return nil
+	}
+	err := lo.Flush()
+	if lo.temporary {
+		if C.OCI_LobFree(lo.handle) != C.TRUE && err == nil {
+			err = getLastErr()
+		}
+	}
+	lo.handle, lo.rbuf, lo.wbuf = nil, nil, nil
+	return err
+}
+
+// readAll reads the whole LOB from the start.
+func (lo *LOB) readAll() ([]byte, error) {
+	if _, err := lo.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(lo)
+}
+
+type File struct {
+	handle *C.OCI_File
+}
+
+func (fi File) Type() C.uint {
+	return C.OCI_FileGetType(fi.handle)
 }
 
 type Long struct {
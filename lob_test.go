@@ -0,0 +1,104 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLOBStream(t *testing.T) {
+	cx, st := testStatement(t)
+	lob, err := cx.NewLOB(CLOB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lob.Close()
+
+	// more than a buffer, written in pieces which split the runes
+	text := strings.Repeat("árvíztűrő tükörfúrógép ", 5000)
+	for b := []byte(text); len(b) > 0; {
+		n := 7
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err = lob.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if size, err := lob.Size(); err != nil || size != int64(utf8.RuneCountInString(text)) {
+		t.Errorf("got size %d (%v), wanted %d characters", size, err, utf8.RuneCountInString(text))
+	}
+
+	if _, err = lob.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(lob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != text {
+		t.Errorf("read %d bytes, wanted %d", len(b), len(text))
+	}
+
+	// the offsets of CLOBs are in characters
+	if _, err = lob.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, len("tükör"))
+	if _, err = io.ReadFull(lob, p); err != nil || string(p) != "tükör" {
+		t.Errorf("got %q (%v) at 10, wanted tükör", p, err)
+	}
+	if err = lob.Truncate(9); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = lob.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = io.ReadAll(lob); err != nil || string(b) != "árvíztűrő" {
+		t.Errorf("got %q (%v) after Truncate(9)", b, err)
+	}
+
+	// fetched LOBs are streamed into *LOB destinations
+	if err = st.Execute("SELECT TO_BLOB(HEXTORAW('00010203FF')) FROM DUAL"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := st.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if err = rs.Next(); err != nil {
+		t.Fatal(err)
+	}
+	row := []driver.Value{(*LOB)(nil)}
+	if err = rs.FetchInto(row); err != nil {
+		t.Fatal(err)
+	}
+	blob, ok := row[0].(*LOB)
+	if !ok {
+		t.Fatalf("got %T, wanted *LOB", row[0])
+	}
+	if b, err = io.ReadAll(blob); err != nil || !bytes.Equal(b, []byte{0, 1, 2, 3, 0xff}) {
+		t.Errorf("got %x (%v)", b, err)
+	}
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib_internal.h"
+//
+// /* OCILIB converts the NUMBER attributes and elements through int64 or double,
+//    so their OCINumbers are reached the way OCI_ObjectGetNumber
+//    and OCI_ElemGetNumber reach them (needs the vendored OCILIB sources). */
+// static void *objectNumber(OCI_Object *obj, const char *attr, OCIInd **ind) {
+//     int i = OCI_ObjectGetAttrIndex(obj, (const mtext *)attr, OCI_CDT_NUMERIC);
+//     return i < 0 ? NULL : OCI_ObjectGetAttr(obj, (unsigned int)i, ind);
+// }
+// static void *objectErrorHandle(OCI_Object *obj) { return obj->con->err; }
+// static void *elemNumber(OCI_Elem *elem) { return elem->handle; }
+// static void *elemErrorHandle(OCI_Elem *elem) { return elem->con->err; }
+// static void elemSetNotNull(OCI_Elem *elem) { OCI_ElemSetNullIndicator(elem, OCI_IND_NOTNULL); }
+// /* the NUMBER columns are defined as OCINumber (SQLT_VNU), see OCI_ColumnMap */
+// static void *defineNumber(OCI_Resultset *rs, unsigned int i) {
+//     OCI_Define *def = OCI_GetDefine(rs, i);
+//     return def == NULL || def->col.icode != SQLT_VNU ? NULL : OCI_DefineGetData(def);
+// }
+// static void *resultsetErrorHandle(OCI_Resultset *rs) { return rs->stmt->con->err; }
+import "C"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxNumberDigits is the maximal number of significant digits of an Oracle NUMBER.
+const maxNumberDigits = 40
+
+// NumberMode says how FetchInto returns the NUMBER columns
+// for destinations without a concrete type (nil or interface{}).
+type NumberMode uint8
+
+const (
+	// NumberAuto returns int64 for integers of at most 19 digits,
+	// and the decimal text (string) otherwise.
+	NumberAuto = NumberMode(iota)
+	// NumberAsNumber always returns Number.
+	NumberAsNumber
+	// NumberAsBig returns *big.Int for integers, and *big.Rat otherwise.
+	NumberAsBig
+)
+
+// Number is an Oracle NUMBER in decimal text form ("-12.345", "1E+125"),
+// preserving its full precision. The empty Number is NULL.
+//
+// FetchInto fills Number, *Number, *big.Int and *big.Rat destinations
+// from NUMBER columns, and BindName accepts Number.
+type Number string
+
+// numberAt returns the (not NULL) column's value as Number: the NUMBERs exactly,
+// the BINARY_FLOATs and BINARY_DOUBLEs as the shortest text which parses back
+// to them, and the other columns' text.
+func (rs *Resultset) numberAt(ui C.uint) (Number, error) {
+	if num := C.defineNumber(rs.handle, ui); num != nil {
+		return ociNumberText(C.resultsetErrorHandle(rs.handle), num)
+	}
+	col := C.OCI_GetColumn(rs.handle, ui)
+	if ColType(C.OCI_ColumnGetType(col)) == ColNumeric {
+		switch C.OCI_ColumnGetSubType(col) {
+		case C.OCI_NUM_FLOAT:
+			return Number(strconv.FormatFloat(float64(C.OCI_GetFloat(rs.handle, ui)), 'G', -1, 32)), nil
+		case C.OCI_NUM_DOUBLE:
+			return Number(strconv.FormatFloat(float64(C.OCI_GetDouble(rs.handle, ui)), 'G', -1, 64)), nil
+		}
+	}
+	return normalizeNumber(C.GoString(C.OCI_GetString(rs.handle, ui))), nil
+}
+
+// getObjectNumber returns the NUMBER attribute of obj, exactly.
+func getObjectNumber(obj *C.OCI_Object, attr *C.char) (Number, error) {
+	num := C.objectNumber(obj, attr, nil)
+	if num == nil {
+		return "", getLastErr()
+	}
+	return ociNumberText(C.objectErrorHandle(obj), num)
+}
+
+// setObjectNumber sets the NUMBER attribute of obj to n, exactly.
+func setObjectNumber(obj *C.OCI_Object, attr *C.char, n Number) error {
+	var ind *C.OCIInd
+	num := C.objectNumber(obj, attr, &ind)
+	if num == nil {
+		return getLastErr()
+	}
+	if err := setOCINumber(C.objectErrorHandle(obj), num, n); err != nil {
+		return err
+	}
+	*ind = C.OCI_IND_NOTNULL
+	return nil
+}
+
+// getElemNumber returns the NUMBER element, exactly.
+func getElemNumber(elem *C.OCI_Elem) (Number, error) {
+	return ociNumberText(C.elemErrorHandle(elem), C.elemNumber(elem))
+}
+
+// setElemNumber sets the NUMBER element to n, exactly.
+func setElemNumber(elem *C.OCI_Elem, n Number) error {
+	if err := setOCINumber(C.elemErrorHandle(elem), C.elemNumber(elem), n); err != nil {
+		return err
+	}
+	C.elemSetNotNull(elem)
+	return nil
+}
+
+// ParseNumber checks that s is a decimal number, and returns it as Number.
+// The decimal separator can be a comma, too.
+func ParseNumber(s string) (Number, error) {
+	n := normalizeNumber(s)
+	if _, ok := new(big.Rat).SetString(string(n)); !ok {
+		return "", fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+// normalizeNumber returns the number text with a '.' decimal separator,
+// and an integer part.
+func normalizeNumber(s string) Number {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	if strings.HasPrefix(s, ".") {
+		s = "0" + s
+	} else if strings.HasPrefix(s, "-.") {
+		s = "-0" + s[1:]
+	}
+	return Number(s)
+}
+
+// decimal returns n as digits × 10^exp, without leading and trailing zeros in digits
+// ("" for zero), and its sign.
+func (n Number) decimal() (neg bool, digits string, exp int, err error) {
+	s := string(normalizeNumber(string(n)))
+	if s == "" {
+		return false, "", 0, fmt.Errorf("%q is not a number", string(n))
+	}
+	switch s[0] {
+	case '-':
+		neg, s = true, s[1:]
+	case '+':
+		s = s[1:]
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil {
+			return false, "", 0, fmt.Errorf("%q is not a number", string(n))
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return false, "", 0, fmt.Errorf("%q is not a number", string(n))
+	}
+	digits = strings.TrimLeft(s, "0")
+	for len(digits) > 0 && digits[len(digits)-1] == '0' {
+		digits, exp = digits[:len(digits)-1], exp+1
+	}
+	return neg && digits != "", digits, exp, nil
+}
+
+// NumberFromInt64 returns i as a Number.
+func NumberFromInt64(i int64) Number {
+	return Number(strconv.FormatInt(i, 10))
+}
+
+// NumberFromBigInt returns i as a Number.
+func NumberFromBigInt(i *big.Int) Number {
+	return Number(i.String())
+}
+
+// NumberFromBigRat returns r as a Number, rounded to prec decimal digits.
+func NumberFromBigRat(r *big.Rat, prec int) Number {
+	s := r.FloatString(prec)
+	if prec > 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return Number(s)
+}
+
+// String returns the decimal text.
+func (n Number) String() string {
+	return string(n)
+}
+
+// IsNull reports whether n is NULL.
+func (n Number) IsNull() bool {
+	return n == ""
+}
+
+// Int64 returns n as an int64, or an error if it is not an integer,
+// or does not fit.
+func (n Number) Int64() (int64, error) {
+	i, err := strconv.ParseInt(string(n), 10, 64)
+	if err == nil {
+		return i, nil
+	}
+	bi, err := n.BigInt()
+	if err != nil {
+		return 0, err
+	}
+	if !bi.IsInt64() {
+		return 0, fmt.Errorf("%s overflows int64", n)
+	}
+	return bi.Int64(), nil
+}
+
+// Float64 returns n as the nearest float64.
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// BigInt returns n as a *big.Int, or an error if it is not an integer.
+func (n Number) BigInt() (*big.Int, error) {
+	r, err := n.BigRat()
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%s is not an integer", n)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// BigRat returns n as a *big.Rat.
+func (n Number) BigRat() (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", string(n))
+	}
+	return r, nil
+}
+
+var (
+	numberType = reflect.TypeOf(Number(""))
+	bigIntType = reflect.TypeOf(big.Int{})
+	bigRatType = reflect.TypeOf(big.Rat{})
+)
+
+// as returns n converted for a destination of type t: *big.Int, *big.Rat,
+// int64, uint64, float64 or string for those kinds of types, n itself otherwise.
+func (n Number) as(t reflect.Type) (interface{}, error) {
+	switch t {
+	case bigIntType:
+		return n.BigInt()
+	case bigRatType:
+		return n.BigRat()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return n.Int64()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(string(n), 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return n.Float64()
+	case reflect.String:
+		return string(n), nil
+	}
+	return n, nil
+}
+
+// exactNumber returns the string (see ParseNumber), big.Int or big.Rat value as Number,
+// "" for the other types.
+func exactNumber(value interface{}) (Number, error) {
+	switch x := value.(type) {
+	case big.Int:
+		return NumberFromBigInt(&x), nil
+	case big.Rat:
+		if x.IsInt() {
+			return NumberFromBigInt(x.Num()), nil
+		}
+		return NumberFromBigRat(&x, maxNumberDigits), nil
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.String {
+		return ParseNumber(rv.String())
+	}
+	return "", nil
+}
+
+// setBigInt sets x to n, and reports whether n is an integer.
+func setBigInt(x *big.Int, n Number) bool {
+	bi, err := n.BigInt()
+	if err != nil {
+		return false
+	}
+	x.Set(bi)
+	return true
+}
+
+// setBigRat sets x to n, and reports whether n is a number.
+func setBigRat(x *big.Rat, n Number) bool {
+	r, err := n.BigRat()
+	if err != nil {
+		return false
+	}
+	x.Set(r)
+	return true
+}
+
+// Scan implements sql.Scanner.
+func (n *Number) Scan(src interface{}) error {
+	switch x := src.(type) {
+	case nil:
+		*n = ""
+	case Number:
+		*n = x
+	case string:
+		return n.scanText(x)
+	case []byte:
+		return n.scanText(string(x))
+	case int64:
+		*n = NumberFromInt64(x)
+	case float64:
+		*n = Number(strconv.FormatFloat(x, 'f', -1, 64))
+	case *big.Int:
+		*n = NumberFromBigInt(x)
+	case *big.Rat:
+		if x.IsInt() {
+			*n = NumberFromBigInt(x.Num())
+		} else {
+			*n = NumberFromBigRat(x, maxNumberDigits)
+		}
+	default:
+		return fmt.Errorf("cannot scan %T into Number", src)
+	}
+	return nil
+}
+
+func (n *Number) scanText(s string) error {
+	v, err := ParseNumber(s)
+	if err != nil {
+		return err
+	}
+	*n = v
+	return nil
+}
+
+// Value implements driver.Valuer: returns the decimal text, or nil for NULL.
+func (n Number) Value() (driver.Value, error) {
+	if n == "" {
+		return nil, nil
+	}
+	return string(n), nil
+}
@@ -0,0 +1,782 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// ObjectType describes an Oracle object type (ADT).
+type ObjectType struct {
+	handle *C.OCI_TypeInfo
+	// Name is the name of the type.
+	Name string
+	// Attributes are the attributes of the type, in definition order.
+	Attributes []ObjectAttribute
+}
+
+// ObjectAttribute is an attribute of an ObjectType.
+type ObjectAttribute struct {
+	Name string
+	Type ColType
+	// TypeName is the SQL type of the attribute, such as VARCHAR2.
+	TypeName string
+	// Size is the byte size, Precision and Scale are for the NUMBER attributes.
+	Size, Precision, Scale int
+	// ObjectType is the type of the object, REF and collection attributes.
+	ObjectType *ObjectType
+
+	subType C.uint // the OCI_TIMESTAMP_* or OCI_INTERVAL_* type
+}
+
+// ObjectTypeNamer is implemented by the Go structs which can be bound
+// as Oracle objects: BindName converts them to an object of the named type
+// with Object.FromStruct. Pointers to such structs are bound as IN OUT,
+// and are filled back with Object.ToStruct after the execution.
+//
+// Slice types implementing it are bound as collections of the named type
+// the same way, with Coll.FromSlice and Coll.ToSlice.
+type ObjectTypeNamer interface {
+	ObjectTypeName() string
+}
+
+// ObjectType returns the description of the named object type.
+func (conn *Connection) ObjectType(name string) (*ObjectType, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	nm := C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	handle := C.OCI_TypeInfoGet(conn.handle, nm, C.OCI_TIF_TYPE)
+	if handle == nil {
+		if err := getLastErr(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ObjectType(%s): no such type", name)
+	}
+	return conn.objectType(handle), nil
+}
+
+// objectType returns the ObjectType of the type info handle,
+// cached in the connection (if not nil).
+func (conn *Connection) objectType(handle *C.OCI_TypeInfo) *ObjectType {
+	if conn == nil {
+		return newObjectType(handle, make(map[*C.OCI_TypeInfo]*ObjectType))
+	}
+	conn.typesMu.Lock()
+	defer conn.typesMu.Unlock()
+	if conn.types == nil {
+		conn.types = make(map[*C.OCI_TypeInfo]*ObjectType)
+	}
+	return newObjectType(handle, conn.types)
+}
+
+// newObjectType describes the type info handle, using and filling the types cache
+// (which makes the self-referencing types possible).
+func newObjectType(handle *C.OCI_TypeInfo, types map[*C.OCI_TypeInfo]*ObjectType) *ObjectType {
+	if typ, ok := types[handle]; ok {
+		return typ
+	}
+	typ := &ObjectType{handle: handle, Name: C.GoString(C.OCI_TypeInfoGetName(handle))}
+	types[handle] = typ
+	n := int(C.OCI_TypeInfoGetColumnCount(handle))
+	typ.Attributes = make([]ObjectAttribute, n)
+	for i := range typ.Attributes {
+		c := C.OCI_TypeInfoGetColumn(handle, C.uint(i+1))
+		a := &typ.Attributes[i]
+		a.Name = C.GoString(C.OCI_ColumnGetName(c))
+		a.Type = ColType(C.OCI_ColumnGetType(c))
+		a.TypeName = C.GoString(C.OCI_ColumnGetSQLType(c))
+		a.Size = int(C.OCI_ColumnGetSize(c))
+		a.Precision = int(C.OCI_ColumnGetPrecision(c))
+		a.Scale = int(C.OCI_ColumnGetScale(c))
+		a.subType = C.OCI_ColumnGetSubType(c)
+		switch a.Type {
+		case ColObject, ColRef, ColCollection:
+			if ti := C.OCI_ColumnGetTypeInfo(c); ti != nil {
+				a.ObjectType = newObjectType(ti, types)
+			}
+		}
+	}
+	return typ
+}
+
+// Attribute returns the named attribute (case-insensitively).
+func (typ *ObjectType) Attribute(name string) (ObjectAttribute, bool) {
+	for _, a := range typ.Attributes {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return ObjectAttribute{}, false
+}
+
+// number returns the NUMBER value as the mode says. With NumberAuto,
+// it is int64 for the integer attributes, and for the integral values
+// of the unconstrained NUMBER attributes, float64 otherwise.
+func (a ObjectAttribute) number(n Number, mode NumberMode) (interface{}, error) {
+	switch mode {
+	case NumberAsNumber:
+		return n, nil
+	case NumberAsBig:
+		if bi := new(big.Int); setBigInt(bi, n) {
+			return bi, nil
+		}
+		return n.BigRat()
+	}
+	if a.Scale == 0 || a.Precision == 0 {
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return n.Float64()
+}
+
+// Object is an instance of an Oracle object type.
+//
+// An Object fetched by FetchInto is valid only till the next fetch;
+// the Objects created with NewObject must be closed after use.
+type Object struct {
+	handle *C.OCI_Object
+	conn   *Connection
+	typ    *ObjectType
+	owned  bool // created by NewObject, freed by Close
+
+	// numberMode is the NumberMode of the statement which has fetched the object.
+	numberMode NumberMode
+}
+
+// NewObject creates a new object of the named type, with all attributes NULL.
+func (conn *Connection) NewObject(typeName string) (*Object, error) {
+	typ, err := conn.ObjectType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	return conn.newObject(typ)
+}
+
+func (conn *Connection) newObject(typ *ObjectType) (*Object, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	obj := Object{handle: C.OCI_ObjectCreate(conn.handle, typ.handle), conn: conn, typ: typ, owned: true}
+	if obj.handle == nil {
+		return nil, getLastErr()
+	}
+	return &obj, nil
+}
+
+// newFetchedObject returns the object got from OCILIB, not to be freed.
+func (conn *Connection) newFetchedObject(handle *C.OCI_Object) *Object {
+	return &Object{handle: handle, conn: conn, typ: conn.objectType(C.OCI_ObjectGetTypeInfo(handle))}
+}
+
+func (ob Object) Type() *C.OCI_TypeInfo {
+	return C.OCI_ObjectGetTypeInfo(ob.handle)
+}
+
+// ObjectType returns the type of the object.
+func (ob *Object) ObjectType() *ObjectType {
+	if ob.typ == nil {
+		ob.typ = ob.conn.objectType(ob.Type())
+	}
+	return ob.typ
+}
+
+// Close frees the object, if it has been created by NewObject.
+func (ob *Object) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if ob == nil || ob.handle == nil {
+		return nil
+	}
+	var err error
+	if ob.owned && C.OCI_ObjectFree(ob.handle) != C.TRUE {
+		err = getLastErr()
+	}
+	ob.handle = nil
+	return err
+}
+
+// attribute returns the named attribute, or an error.
+func (ob *Object) attribute(name string) (ObjectAttribute, error) {
+	a, ok := ob.ObjectType().Attribute(name)
+	if !ok {
+		return a, fmt.Errorf("%s has no attribute %q", ob.typ.Name, name)
+	}
+	return a, nil
+}
+
+// IsNull reports whether the named attribute is NULL.
+func (ob *Object) IsNull(attr string) bool {
+	nm := C.CString(attr)
+	defer C.free(unsafe.Pointer(nm))
+	return C.OCI_ObjectIsNull(ob.handle, nm) == C.TRUE
+}
+
+// SetNull sets the named attribute to NULL.
+func (ob *Object) SetNull(attr string) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, err := ob.attribute(attr); err != nil {
+		return err
+	}
+	nm := C.CString(attr)
+	defer C.free(unsafe.Pointer(nm))
+	if C.OCI_ObjectSetNull(ob.handle, nm) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Get returns the value of the named attribute: nil for NULL, and
+// int64 or float64 for NUMBER (or as the NumberMode of the statement
+// which has fetched the object says), string, []byte, time.Time, time.Duration,
+// *LOB, *Object (for nested objects), *Ref or *Coll.
+//
+// The returned *LOB, *Object, *Ref and *Coll are valid only while ob is.
+func (ob *Object) Get(attr string) (interface{}, error) {
+	return ob.get(attr, ob.numberMode)
+}
+
+// get is Get, returning the NUMBER attributes as mode says.
+func (ob *Object) get(attr string, mode NumberMode) (interface{}, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	a, err := ob.attribute(attr)
+	if err != nil {
+		return nil, err
+	}
+	nm := C.CString(attr)
+	defer C.free(unsafe.Pointer(nm))
+	if C.OCI_ObjectIsNull(ob.handle, nm) == C.TRUE {
+		return nil, nil
+	}
+	switch a.Type {
+	case ColNumeric:
+		n, err := getObjectNumber(ob.handle, nm)
+		if err != nil {
+			return nil, fmt.Errorf("Get(%s): %v", attr, err)
+		}
+		return a.number(n, mode)
+	case ColText:
+		return C.GoString(C.OCI_ObjectGetString(ob.handle, nm)), nil
+	case ColRaw:
+		b := make([]byte, a.Size)
+		if len(b) == 0 {
+			return b, nil
+		}
+		n := C.OCI_ObjectGetRaw(ob.handle, nm, unsafe.Pointer(&b[0]), C.uint(len(b)))
+		return b[:n], nil
+	case ColDate:
+		if od := C.OCI_ObjectGetDate(ob.handle, nm); od != nil {
+			return ociDateToTime(od)
+		}
+	case ColTimestamp:
+		if ts := C.OCI_ObjectGetTimestamp(ob.handle, nm); ts != nil {
+			return ociTimestampToTime(ts)
+		}
+	case ColInterval:
+		if oi := C.OCI_ObjectGetInterval(ob.handle, nm); oi != nil {
+			return ociIntervalValue(oi)
+		}
+	case ColLob:
+		if lob := C.OCI_ObjectGetLob(ob.handle, nm); lob != nil {
+			return &LOB{handle: lob}, nil
+		}
+	case ColObject:
+		if o := C.OCI_ObjectGetObject(ob.handle, nm); o != nil {
+			return &Object{handle: o, conn: ob.conn, typ: a.ObjectType, numberMode: ob.numberMode}, nil
+		}
+	case ColRef:
+		if r := C.OCI_ObjectGetRef(ob.handle, nm); r != nil {
+			return &Ref{handle: r, conn: ob.conn}, nil
+		}
+	case ColCollection:
+		if co := C.OCI_ObjectGetColl(ob.handle, nm); co != nil {
+			return &Coll{handle: co, conn: ob.conn, typ: a.ObjectType, numberMode: ob.numberMode}, nil
+		}
+	case ColFile:
+		if fi := C.OCI_ObjectGetFile(ob.handle, nm); fi != nil {
+			return File{handle: fi}, nil
+		}
+	default:
+		return nil, fmt.Errorf("Get(%s): unsupported attribute type %s", attr, a.Type)
+	}
+	if err := getLastErr(); err != nil {
+		return nil, fmt.Errorf("Get(%s): %v", attr, err)
+	}
+	return nil, nil
+}
+
+// Set sets the named attribute to value. nil sets NULL.
+//
+// A nested object attribute can be set from an *Object, or from a struct
+// (see FromStruct); a REF attribute from a *Ref; a collection attribute
+// from a *Coll, or from a slice (see Coll.FromSlice).
+func (ob *Object) Set(attr string, value interface{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	a, err := ob.attribute(attr)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return ob.SetNull(attr)
+	}
+	if v, ok := value.(driver.Valuer); ok {
+		if _, isObj := value.(ObjectTypeNamer); !isObj {
+			if value, err = v.Value(); err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			if value == nil {
+				return ob.SetNull(attr)
+			}
+		}
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr && rv.Type() != lobPtrType && rv.Type() != objectPtrType &&
+		rv.Type() != refPtrType && rv.Type() != collPtrType {
+		if rv.IsNil() {
+			return ob.SetNull(attr)
+		}
+		return ob.Set(attr, rv.Elem().Interface())
+	}
+	nm := C.CString(attr)
+	defer C.free(unsafe.Pointer(nm))
+	ok := C.int(C.FALSE)
+	switch a.Type {
+	case ColNumeric:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ok = C.OCI_ObjectSetBigInt(ob.handle, nm, C.big_int(rv.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ok = C.OCI_ObjectSetUnsignedBigInt(ob.handle, nm, C.big_uint(rv.Uint()))
+		case reflect.Float32, reflect.Float64:
+			ok = C.OCI_ObjectSetDouble(ob.handle, nm, C.double(rv.Float()))
+		default:
+			n, err := exactNumber(value)
+			if err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			if n == "" {
+				return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+			}
+			if err = setObjectNumber(ob.handle, nm, n); err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			return nil
+		}
+	case ColText:
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+		s := C.CString(rv.String())
+		defer C.free(unsafe.Pointer(s))
+		ok = C.OCI_ObjectSetString(ob.handle, nm, (*C.dtext)(unsafe.Pointer(s)))
+	case ColRaw:
+		b, isBytes := value.([]byte)
+		if !isBytes {
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+		if len(b) == 0 {
+			return ob.SetNull(attr)
+		}
+		ok = C.OCI_ObjectSetRaw(ob.handle, nm, unsafe.Pointer(&b[0]), C.uint(len(b)))
+	case ColDate:
+		t, isTime := value.(time.Time)
+		if !isTime {
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+		od, err := newOCIDate(ob.conn.cHandle(), t)
+		if err != nil {
+			return fmt.Errorf("Set(%s): %v", attr, err)
+		}
+		defer C.OCI_DateFree(od)
+		ok = C.OCI_ObjectSetDate(ob.handle, nm, od)
+	case ColTimestamp:
+		t, isTime := value.(time.Time)
+		if !isTime {
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+		ts, err := newOCITimestamp(ob.conn.cHandle(), a.subType, t)
+		if err != nil {
+			return fmt.Errorf("Set(%s): %v", attr, err)
+		}
+		defer C.OCI_TimestampFree(ts)
+		ok = C.OCI_ObjectSetTimestamp(ob.handle, nm, ts)
+	case ColInterval:
+		oi, err := newOCIInterval(ob.conn.cHandle(), a.subType, value)
+		if err != nil {
+			return fmt.Errorf("Set(%s): %v", attr, err)
+		}
+		defer C.OCI_IntervalFree(oi)
+		ok = C.OCI_ObjectSetInterval(ob.handle, nm, oi)
+	case ColLob:
+		switch x := value.(type) {
+		case *LOB:
+			if err := x.Flush(); err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			ok = C.OCI_ObjectSetLob(ob.handle, nm, x.handle)
+		case LOB:
+			ok = C.OCI_ObjectSetLob(ob.handle, nm, x.handle)
+		default:
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+	case ColObject:
+		switch x := value.(type) {
+		case *Object:
+			ok = C.OCI_ObjectSetObject(ob.handle, nm, x.handle)
+		case Object:
+			ok = C.OCI_ObjectSetObject(ob.handle, nm, x.handle)
+		default:
+			if rv.Kind() != reflect.Struct || a.ObjectType == nil {
+				return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+			}
+			sub, err := ob.conn.newObject(a.ObjectType)
+			if err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			defer sub.Close()
+			if err = sub.FromStruct(value); err != nil {
+				return fmt.Errorf("Set(%s): %v", attr, err)
+			}
+			ok = C.OCI_ObjectSetObject(ob.handle, nm, sub.handle)
+		}
+	case ColRef:
+		switch x := value.(type) {
+		case *Ref:
+			ok = C.OCI_ObjectSetRef(ob.handle, nm, x.handle)
+		case Ref:
+			ok = C.OCI_ObjectSetRef(ob.handle, nm, x.handle)
+		default:
+			return fmt.Errorf("Set(%s): cannot set %T as %s", attr, value, a.Type)
+		}
+	case ColCollection:
+		co, free, err := ob.conn.toColl(a.ObjectType, value)
+		if err != nil {
+			return fmt.Errorf("Set(%s): %v", attr, err)
+		}
+		defer free()
+		ok = C.OCI_ObjectSetColl(ob.handle, nm, co.handle)
+	default:
+		return fmt.Errorf("Set(%s): unsupported attribute type %s", attr, a.Type)
+	}
+	if ok != C.TRUE {
+		return fmt.Errorf("Set(%s): %v", attr, getLastErr())
+	}
+	return nil
+}
+
+var (
+	lobPtrType    = reflect.TypeOf((*LOB)(nil))
+	objectPtrType = reflect.TypeOf((*Object)(nil))
+	refPtrType    = reflect.TypeOf((*Ref)(nil))
+	collPtrType   = reflect.TypeOf((*Coll)(nil))
+	objectType    = reflect.TypeOf(Object{})
+	refType       = reflect.TypeOf(Ref{})
+	collType      = reflect.TypeOf(Coll{})
+)
+
+// ToStruct copies the attributes of the object into the struct dst points to.
+//
+// The attributes are mapped to the fields as ScanStruct maps the columns:
+// by the `oracle:"ATTR_NAME"` tag, or by the case-insensitive field name.
+// Nested objects are copied into struct fields, REFs are dereferenced
+// into struct fields, or copied into *Ref fields, collections are copied
+// into slice fields (see Coll.ToSlice).
+// NULLs are returned as nil for pointer fields, and as the zero value otherwise.
+func (ob *Object) ToStruct(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ToStruct: dst must be a non-nil pointer to a struct, not %T", dst)
+	}
+	v = v.Elem()
+	byName := make(map[string][]int)
+	collectFields(v.Type(), nil, byName, make(map[string]int))
+	for _, a := range ob.ObjectType().Attributes {
+		path := byName[strings.ToUpper(a.Name)]
+		if path == nil {
+			continue
+		}
+		f := fieldByIndex(v, path)
+		val, err := ob.get(a.Name, fieldNumberMode(f.Type(), ob.numberMode))
+		if err != nil {
+			return err
+		}
+		if err = assignAttr(f, val); err != nil {
+			return fmt.Errorf("ToStruct: attribute %s: %v", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldNumberMode returns the NumberMode for getting a NUMBER into a field of type ft:
+// the exact Number for the concrete types (converted by assignAttr), mode for interface{}.
+func fieldNumberMode(ft reflect.Type, mode NumberMode) NumberMode {
+	if ft.Kind() == reflect.Interface {
+		return mode
+	}
+	return NumberAsNumber
+}
+
+// assignAttr sets f to the attribute value, copying the objects into structs.
+func assignAttr(f reflect.Value, val interface{}) error {
+	ft := f.Type()
+	if ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if n, ok := val.(Number); ok && ft != numberType {
+		var err error
+		if val, err = n.as(ft); err != nil {
+			return err
+		}
+	}
+	if co, ok := val.(*Coll); ok && ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+		p := reflect.New(ft)
+		if err := co.ToSlice(p.Interface()); err != nil {
+			return err
+		}
+		if f.Kind() == reflect.Ptr {
+			f.Set(p)
+		} else {
+			f.Set(p.Elem())
+		}
+		return nil
+	}
+	if ft.Kind() == reflect.Struct && ft != timeType && ft != objectType && ft != refType && ft != collType {
+		var obj *Object
+		switch x := val.(type) {
+		case *Object:
+			obj = x
+		case *Ref:
+			var err error
+			if obj, err = x.Object(); err != nil {
+				return err
+			}
+		}
+		if obj != nil {
+			p := reflect.New(ft)
+			if err := obj.ToStruct(p.Interface()); err != nil {
+				return err
+			}
+			if f.Kind() == reflect.Ptr {
+				f.Set(p)
+			} else {
+				f.Set(p.Elem())
+			}
+			return nil
+		}
+	}
+	if lob, ok := val.(*LOB); ok && ft != lobPtrType.Elem() {
+		b, err := lob.readAll()
+		if err != nil {
+			return err
+		}
+		if ft.Kind() == reflect.String {
+			return assignValue(f, string(b))
+		}
+		return assignValue(f, b)
+	}
+	return assignValue(f, val)
+}
+
+// FromStruct sets the attributes of the object from the fields of src,
+// which must be a struct or a pointer to a struct. See ToStruct for the mapping.
+// Nil pointer fields set NULL.
+func (ob *Object) FromStruct(src interface{}) error {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("FromStruct: src must be a struct, not %T", src)
+	}
+	byName := make(map[string][]int)
+	collectFields(v.Type(), nil, byName, make(map[string]int))
+	for _, a := range ob.ObjectType().Attributes {
+		path := byName[strings.ToUpper(a.Name)]
+		if path == nil {
+			continue
+		}
+		f, ok := fieldByIndexNoAlloc(v, path)
+		if !ok {
+			if err := ob.SetNull(a.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ob.Set(a.Name, f.Interface()); err != nil {
+			return fmt.Errorf("FromStruct: %v", err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndexNoAlloc is like reflect.Value.FieldByIndex, but returns false
+// if an embedded struct pointer is nil.
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// bindStruct binds the struct as an object of its ObjectTypeName.
+// A pointer is bound as IN OUT: the struct is filled back after the execution,
+// and a nil pointer is bound as NULL.
+func (stmt *Statement) bindStruct(name string, v ObjectTypeNamer) error {
+	obj, err := stmt.conn.NewObject(v.ObjectTypeName())
+	if err != nil {
+		return fmt.Errorf("BindName(%s): %v", name, err)
+	}
+	stmt.objects = append(stmt.objects, obj)
+	rv := reflect.ValueOf(v)
+	isNil := rv.Kind() == reflect.Ptr && rv.IsNil()
+	if !isNil {
+		if err = obj.FromStruct(v); err != nil {
+			return fmt.Errorf("BindName(%s): %v", name, err)
+		}
+	}
+	nm := C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	if C.OCI_BindObject(stmt.handle, nm, obj.handle) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	bnd := C.OCI_GetBind2(stmt.handle, nm)
+	if isNil && C.OCI_BindSetNull(bnd) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	if rv.Kind() != reflect.Ptr || isNil {
+		return nil
+	}
+	stmt.outs = append(stmt.outs, func() error {
+		if C.OCI_BindIsNull(bnd) == C.TRUE {
+			rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+			return nil
+		}
+		if err := obj.ToStruct(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// freeBinds frees the objects, collections and other C values created for the binds.
+func (stmt *Statement) freeBinds() {
+	for _, obj := range stmt.objects {
+		obj.Close()
+	}
+	for _, co := range stmt.colls {
+		co.Close()
+	}
+	for _, f := range stmt.frees {
+		f()
+	}
+	stmt.objects, stmt.colls, stmt.frees = stmt.objects[:0], stmt.colls[:0], stmt.frees[:0]
+}
+
+// connection returns the connection of the statement, or nil.
+func (stmt *Statement) connection() *Connection {
+	if stmt == nil {
+		return nil
+	}
+	return stmt.conn
+}
+
+// Ref is a REF to an object.
+type Ref struct {
+	handle *C.OCI_Ref
+	conn   *Connection
+}
+
+func (re Ref) Type() *C.OCI_TypeInfo {
+	return C.OCI_RefGetTypeInfo(re.handle)
+}
+
+// IsNull reports whether the REF is NULL.
+func (re *Ref) IsNull() bool {
+	return re == nil || re.handle == nil || C.OCI_RefIsNull(re.handle) == C.TRUE
+}
+
+// Object returns the referenced object, pinned in the object cache.
+func (re *Ref) Object() (*Object, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if re.IsNull() {
+		return nil, nil
+	}
+	handle := C.OCI_RefGetObject(re.handle)
+	if handle == nil {
+		return nil, getLastErr()
+	}
+	return re.conn.newFetchedObject(handle), nil
+}
+
+// String returns the hexadecimal form of the REF.
+func (re *Ref) String() string {
+	if re.IsNull() {
+		return ""
+	}
+	size := C.OCI_RefGetHexSize(re.handle)
+	b := make([]byte, size+1)
+	if C.OCI_RefToText(re.handle, size, (*C.mtext)(unsafe.Pointer(&b[0]))) != C.TRUE {
+		return ""
+	}
+	return C.GoString((*C.char)(unsafe.Pointer(&b[0])))
+}
+
+// cHandle returns the OCI_Connection handle, or nil.
+func (conn *Connection) cHandle() *C.OCI_Connection {
+	if conn == nil {
+		return nil
+	}
+	return conn.handle
+}
+
+// newOCIDate returns a new OCI_Date set to t. It must be freed with OCI_DateFree.
+func newOCIDate(con *C.OCI_Connection, t time.Time) (*C.OCI_Date, error) {
+	od := C.OCI_DateCreate(con)
+	if od == nil {
+		return nil, getLastErr()
+	}
+	y, m, d := t.Date()
+	H, M, S := t.Clock()
+	if C.OCI_DateSetDateTime(od, C.int(y), C.int(m), C.int(d), C.int(H), C.int(M), C.int(S)) != C.TRUE {
+		err := getLastErr()
+		C.OCI_DateFree(od)
+		return nil, err
+	}
+	return od, nil
+}
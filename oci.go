@@ -23,14 +23,168 @@ package gocilib
 //
 //const int sizeof_OraText = sizeof(OraText);
 //
+//#ifdef OCI_RESULT_TYPE_SELECT
+///* the implicit results are new in 12c, as OCI_RESULT_TYPE_SELECT */
+//static sword stmtGetNextResult(OCIStmt *stmthp, OCIError *errhp, void **result) {
+//    ub4 rtype;
+//    return OCIStmtGetNextResult(stmthp, errhp, result, &rtype, OCI_DEFAULT);
+//}
+//#else
+//static sword stmtGetNextResult(OCIStmt *stmthp, OCIError *errhp, void **result) {
+//    return OCI_NO_DATA;
+//}
+//#endif
+//
 import "C"
 
 import (
+	"runtime"
+	"strconv"
+	"strings"
 	"unsafe"
 )
 
+// bindNumber binds n as an OCINumber (SQLT_VNU), bypassing OCILIB.
+// free frees the bound buffer.
+func bindNumber(stmtHandle, errHandle unsafe.Pointer, name string, n Number) (free func(), err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var num C.OCINumber
+	if err = setOCINumber(errHandle, unsafe.Pointer(&num), n); err != nil {
+		return nil, err
+	}
+
+	// OCI reads the value at the execution
+	buf := (*C.OCINumber)(C.malloc(C.size_t(unsafe.Sizeof(num))))
+	*buf = num
+	Cname := C.CString(name)
+	defer C.free(unsafe.Pointer(Cname))
+	var bnd *C.OCIBind
+	if C.OCIBindByName((*C.OCIStmt)(stmtHandle), &bnd, (*C.OCIError)(errHandle),
+		(*C.OraText)(unsafe.Pointer(Cname)), C.sb4(len(name)),
+		unsafe.Pointer(buf), C.sb4(unsafe.Sizeof(num)), C.SQLT_VNU,
+		nil, nil, nil, 0, nil, C.OCI_DEFAULT) != C.OCI_SUCCESS {
+		C.free(unsafe.Pointer(buf))
+		return nil, ociHandleErr(errHandle)
+	}
+	return func() { C.free(unsafe.Pointer(buf)) }, nil
+}
+
+// setOCINumber sets the OCINumber dst points to to n.
+// The OCINumber is built with the OCI number arithmetic from the digits of n,
+// so it does not depend on the NLS settings.
+func setOCINumber(errHandle, dst unsafe.Pointer, n Number) error {
+	neg, digits, exp, err := n.decimal()
+	if err != nil {
+		return err
+	}
+	errh := (*C.OCIError)(errHandle)
+	var num, tmp, part C.OCINumber
+	C.OCINumberSetZero(errh, &num)
+	for len(digits) > 0 {
+		k := len(digits)
+		if k > 18 {
+			k = 18
+		}
+		chunk, _ := strconv.ParseInt(digits[:k], 10, 64)
+		if C.OCINumberShift(errh, &num, C.sword(k), &tmp) != C.OCI_SUCCESS ||
+			C.OCINumberFromInt(errh, unsafe.Pointer(&chunk), C.uword(unsafe.Sizeof(chunk)), C.OCI_NUMBER_SIGNED, &part) != C.OCI_SUCCESS ||
+			C.OCINumberAdd(errh, &tmp, &part, &num) != C.OCI_SUCCESS {
+			return ociHandleErr(errHandle)
+		}
+		digits = digits[k:]
+	}
+	if exp != 0 {
+		if C.OCINumberShift(errh, &num, C.sword(exp), &tmp) != C.OCI_SUCCESS {
+			return ociHandleErr(errHandle)
+		}
+		num = tmp
+	}
+	if neg {
+		if C.OCINumberNeg(errh, &num, &tmp) != C.OCI_SUCCESS {
+			return ociHandleErr(errHandle)
+		}
+		num = tmp
+	}
+	*(*C.OCINumber)(dst) = num
+	return nil
+}
+
+var (
+	numberTextFormat = []byte("TM9")
+	numberTextNLS    = []byte("NLS_NUMERIC_CHARACTERS='.,'")
+)
+
+// ociNumberText returns the OCINumber src points to as Number, exactly
+// (TM9 switches to scientific notation only above 64 characters),
+// independently of the NLS settings.
+func ociNumberText(errHandle, src unsafe.Pointer) (Number, error) {
+	buf := make([]byte, 128)
+	size := C.ub4(len(buf))
+	if C.OCINumberToText((*C.OCIError)(errHandle), (*C.OCINumber)(src),
+		(*C.OraText)(unsafe.Pointer(&numberTextFormat[0])), C.ub4(len(numberTextFormat)),
+		(*C.OraText)(unsafe.Pointer(&numberTextNLS[0])), C.ub4(len(numberTextNLS)),
+		&size, (*C.OraText)(unsafe.Pointer(&buf[0]))) != C.OCI_SUCCESS {
+		return "", ociHandleErr(errHandle)
+	}
+	return normalizeNumber(string(buf[:size])), nil
+}
+
+// transDetach detaches the global transaction branch from the service context,
+// without ending it (unlike OCI_TransactionStop, which rolls it back first).
+func transDetach(svcHandle, errHandle unsafe.Pointer) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCITransDetach((*C.OCISvcCtx)(svcHandle), (*C.OCIError)(errHandle), C.OCI_DEFAULT) != C.OCI_SUCCESS {
+		return ociHandleErr(errHandle)
+	}
+	return nil
+}
+
+// transCommitTwoPhase commits the prepared global transaction branch
+// of the service context (second phase of the two-phase commit).
+func transCommitTwoPhase(svcHandle, errHandle unsafe.Pointer) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCITransCommit((*C.OCISvcCtx)(svcHandle), (*C.OCIError)(errHandle), C.OCI_TRANS_TWOPHASE) != C.OCI_SUCCESS {
+		return ociHandleErr(errHandle)
+	}
+	return nil
+}
+
+// stmtNextResult returns the statement handle of the next implicit result
+// (DBMS_SQL.RETURN_RESULT) of the executed statement, nil if there are no more
+// (or the client is older than 12c).
+func stmtNextResult(stmtHandle, errHandle unsafe.Pointer) (unsafe.Pointer, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var result unsafe.Pointer
+	switch C.stmtGetNextResult((*C.OCIStmt)(stmtHandle), (*C.OCIError)(errHandle), &result) {
+	case C.OCI_SUCCESS, C.OCI_SUCCESS_WITH_INFO:
+		return result, nil
+	case C.OCI_NO_DATA:
+		return nil, nil
+	}
+	return nil, ociHandleErr(errHandle)
+}
+
+// ociHandleErr returns the error of the OCIError handle, for the direct OCI calls
+// (OCILIB's getLastErr does not see these).
+func ociHandleErr(errHandle unsafe.Pointer) error {
+	var code C.sb4
+	buf := make([]byte, 1024)
+	C.OCIErrorGet(errHandle, 1, nil, &code, (*C.OraText)(unsafe.Pointer(&buf[0])), C.ub4(len(buf)), C.OCI_HTYPE_ERROR)
+	return &Error{
+		Code: int(code),
+		Text: strings.TrimSpace(C.GoString((*C.char)(unsafe.Pointer(&buf[0])))),
+		Type: ErrOracle,
+	}
+}
+
 // getBindInfo returns the bind names, using *C.OCIStmt and *C.OCIError handles.
 func getBindInfo(stmtHandle, errHandle unsafe.Pointer, dst []string) ([]string, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	var foundElements C.sb4
 	numElements := 8
 
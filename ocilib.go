@@ -0,0 +1,29 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// OCILIB is built from the vendored sources, with the same options
+// as its headers are included with here: some files reach its internals.
+
+// #cgo CFLAGS: -I${SRCDIR}/third_party/ocilib/include -I${SRCDIR}/third_party/ocilib/src
+// #cgo CFLAGS: -DOCI_IMPORT_LINKAGE -DOCI_CHARSET_ANSI
+// #cgo LDFLAGS: -lclntsh
+import "C"
+
+import (
+	_ "github.com/tgulacsi/gocilib/third_party/ocilib/src"
+)
@@ -0,0 +1,264 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// defaultOutSize is the buffer size for string and raw Out binds without Size.
+const defaultOutSize = 4000
+
+// Out is an OUT or IN OUT bind parameter: the value of Dest is copied back
+// after the execution.
+//
+// Dest must be a pointer to a string, []byte, an integer, a float, a time.Time,
+// or a *Resultset (for ref cursors; close it after use).
+// If Dest is a pointer to a pointer (for example *(*string)), then NULL is
+// returned as nil, otherwise as the zero value.
+//
+// If In is true, the current value of Dest is sent, too (IN OUT).
+//
+// Size is the maximal byte size of a string or []byte value.
+type Out struct {
+	Dest interface{}
+	In   bool
+	Size int
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	resultsetType = reflect.TypeOf(Resultset{})
+)
+
+// bindOut binds the out parameter, and registers the function copying
+// the result back to out.Dest after the execution.
+func (stmt *Statement) bindOut(name string, out Out) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	dest := reflect.ValueOf(out.Dest)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return fmt.Errorf("BindName(%s): Out.Dest must be a non-nil pointer, not %T", name, out.Dest)
+	}
+	elem := dest.Elem()
+	typ := elem.Type()
+	nullable := typ.Kind() == reflect.Ptr
+	if nullable {
+		typ = typ.Elem()
+	}
+	// in is the value to be sent, invalid if it should be NULL
+	var in reflect.Value
+	if out.In {
+		if !nullable {
+			in = elem
+		} else if !elem.IsNil() {
+			in = elem.Elem()
+		}
+	}
+
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	var (
+		ok     C.int
+		bnd    *C.OCI_Bind
+		get    func() (reflect.Value, error)
+		onNull func()
+	)
+	switch {
+	case typ == timeType:
+		// TIMESTAMP WITH TIME ZONE keeps the fractional seconds and the time zone
+		ts := C.OCI_TimestampCreate(C.OCI_StatementGetConnection(h), C.OCI_TIMESTAMP_TZ)
+		if ts == nil {
+			return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+		}
+		stmt.frees = append(stmt.frees, func() { C.OCI_TimestampFree(ts) })
+		if in.IsValid() {
+			if err := setOCITimestamp(ts, C.OCI_TIMESTAMP_TZ, in.Interface().(time.Time)); err != nil {
+				return fmt.Errorf("BindName(%s): %v", name, err)
+			}
+		}
+		ok = C.OCI_BindTimestamp(h, nm, ts)
+		get = func() (reflect.Value, error) {
+			t, err := ociTimestampToTime(ts)
+			return reflect.ValueOf(t), err
+		}
+	case typ.Kind() == reflect.String:
+		size := out.Size
+		if in.IsValid() && in.Len() > size {
+			size = in.Len()
+		}
+		if size <= 0 {
+			size = defaultOutSize
+		}
+		buf := make([]byte, size+1)
+		if in.IsValid() {
+			copy(buf, in.String())
+		}
+		stmt.keep = append(stmt.keep, buf)
+		ok = C.OCI_BindString(h, nm, (*C.dtext)(unsafe.Pointer(&buf[0])), C.uint(size))
+		get = func() (reflect.Value, error) {
+			b := buf
+			if i := bytes.IndexByte(b, 0); i >= 0 {
+				b = b[:i]
+			}
+			return reflect.ValueOf(string(b)).Convert(typ), nil
+		}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		size := out.Size
+		if in.IsValid() && in.Len() > size {
+			size = in.Len()
+		}
+		if size <= 0 {
+			size = defaultOutSize
+		}
+		buf := make([]byte, size)
+		if in.IsValid() {
+			copy(buf, in.Bytes())
+		}
+		stmt.keep = append(stmt.keep, buf)
+		ok = C.OCI_BindRaw(h, nm, unsafe.Pointer(&buf[0]), C.uint(size))
+		if ok == C.TRUE && in.IsValid() {
+			ok = C.OCI_BindSetDataSize(C.OCI_GetBind2(h, nm), C.uint(in.Len()))
+		}
+		get = func() (reflect.Value, error) {
+			n := int(C.OCI_BindGetDataSize(bnd))
+			if n > len(buf) {
+				n = len(buf)
+			}
+			return reflect.ValueOf(append([]byte(nil), buf[:n]...)).Convert(typ), nil
+		}
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64:
+		buf := new(int64)
+		if in.IsValid() {
+			*buf = in.Int()
+		}
+		stmt.keep = append(stmt.keep, buf)
+		ok = C.OCI_BindBigInt(h, nm, (*C.big_int)(unsafe.Pointer(buf)))
+		get = func() (reflect.Value, error) {
+			if reflect.Zero(typ).OverflowInt(*buf) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", *buf, typ)
+			}
+			return reflect.ValueOf(*buf).Convert(typ), nil
+		}
+	case typ.Kind() >= reflect.Uint && typ.Kind() <= reflect.Uint64:
+		// bound as unsigned, so the whole range of uint64 fits
+		buf := new(uint64)
+		if in.IsValid() {
+			*buf = in.Uint()
+		}
+		stmt.keep = append(stmt.keep, buf)
+		ok = C.OCI_BindUnsignedBigInt(h, nm, (*C.big_uint)(unsafe.Pointer(buf)))
+		get = func() (reflect.Value, error) {
+			if reflect.Zero(typ).OverflowUint(*buf) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", *buf, typ)
+			}
+			return reflect.ValueOf(*buf).Convert(typ), nil
+		}
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		buf := new(float64)
+		if in.IsValid() {
+			*buf = in.Float()
+		}
+		stmt.keep = append(stmt.keep, buf)
+		ok = C.OCI_BindDouble(h, nm, (*C.double)(buf))
+		get = func() (reflect.Value, error) { return reflect.ValueOf(*buf).Convert(typ), nil }
+	case typ == resultsetType:
+		if out.In {
+			return fmt.Errorf("BindName(%s): ref cursors can be OUT binds only", name)
+		}
+		cur := C.OCI_StatementCreate(C.OCI_StatementGetConnection(h))
+		if cur == nil {
+			return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+		}
+		if ok = C.OCI_BindStatement(h, nm, cur); ok != C.TRUE {
+			C.OCI_StatementFree(cur)
+			break
+		}
+		get = func() (reflect.Value, error) {
+			rs, err := stmt.cursor(cur)
+			if err != nil {
+				C.OCI_StatementFree(cur)
+				return reflect.Value{}, err
+			}
+			rs.owned = true
+			return reflect.ValueOf(*rs), nil
+		}
+		onNull = func() { C.OCI_StatementFree(cur) }
+	default:
+		return fmt.Errorf("BindName(%s): unknown Out type %s", name, typ)
+	}
+	if ok != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+
+	bnd = C.OCI_GetBind2(h, nm)
+	dir := C.uint(C.OCI_BDM_OUT)
+	if out.In {
+		dir = C.OCI_BDM_IN_OUT
+	}
+	if C.OCI_BindSetDirection(bnd, dir) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	if out.In && !in.IsValid() {
+		if C.OCI_BindSetNull(bnd) != C.TRUE {
+			return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+		}
+	}
+
+	stmt.outs = append(stmt.outs, func() error {
+		if C.OCI_BindIsNull(bnd) == C.TRUE {
+			if onNull != nil {
+				onNull()
+			}
+			elem.Set(reflect.Zero(elem.Type()))
+			return nil
+		}
+		v, err := get()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if !nullable {
+			elem.Set(v)
+			return nil
+		}
+		p := reflect.New(typ)
+		p.Elem().Set(v)
+		elem.Set(p)
+		return nil
+	})
+	return nil
+}
+
+// copyOuts copies back the values of the Out binds after the execution,
+// and returns the first error.
+func (stmt *Statement) copyOuts() error {
+	var firstErr error
+	for _, f := range stmt.outs {
+		if err := f(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("copy back %w", err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib_types.h"
+//
+// /* nbelem of OCILIB's opaque struct OCI_Bind is the current number of elements
+//    of a PL/SQL table bind, which OCI reads before and writes after the execution
+//    (OCI_BindGetDataCount returns the capacity). The struct is the one of the
+//    vendored sources, which are the OCILIB linked, see ocilib.go. */
+// static unsigned int bindGetCount(OCI_Bind *bnd) { return bnd->nbelem; }
+// static void bindSetCount(OCI_Bind *bnd, unsigned int n) { bnd->nbelem = n; }
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// PLSQLArray is a PL/SQL associative array (index-by table) bind parameter,
+// such as a parameter of type TABLE OF VARCHAR2(100) INDEX BY PLS_INTEGER.
+// It can be bound in PL/SQL blocks only.
+//
+// Dest is a slice of integers, floats or strings for an IN parameter,
+// or a pointer to such a slice for an OUT or IN OUT parameter: after the
+// execution, the slice is replaced with the returned elements
+// (NULLs as the zero value).
+//
+// If In is true, the current elements of the slice Dest points to are sent, too (IN OUT).
+//
+// MaxLen is the maximal number of elements, at least the length of the slice.
+// Size is the maximal byte size of a string element.
+type PLSQLArray struct {
+	Dest   interface{}
+	In     bool
+	MaxLen int
+	Size   int
+}
+
+// bindPLSQLArray binds arr as a PL/SQL table, and registers the function
+// copying the returned elements back to arr.Dest after the execution.
+func (stmt *Statement) bindPLSQLArray(name string, arr PLSQLArray) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	switch C.OCI_GetStatementType(stmt.handle) {
+	case C.OCI_CST_BEGIN, C.OCI_CST_DECLARE:
+	default:
+		return fmt.Errorf("BindName(%s): PLSQLArray can be bound in PL/SQL blocks only", name)
+	}
+	dest := reflect.ValueOf(arr.Dest)
+	out := dest.Kind() == reflect.Ptr
+	if out {
+		if dest.IsNil() {
+			return fmt.Errorf("BindName(%s): PLSQLArray.Dest must be a non-nil pointer", name)
+		}
+		dest = dest.Elem()
+	}
+	if dest.Kind() != reflect.Slice {
+		return fmt.Errorf("BindName(%s): PLSQLArray.Dest must be a slice or a pointer to a slice, not %T", name, arr.Dest)
+	}
+	in := !out || arr.In
+	n := 0
+	if in {
+		n = dest.Len()
+	}
+	maxLen := arr.MaxLen
+	if maxLen < n {
+		maxLen = n
+	}
+	if maxLen == 0 {
+		return fmt.Errorf("BindName(%s): PLSQLArray.MaxLen must be positive", name)
+	}
+
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	var (
+		ok  C.int
+		get func(i int) reflect.Value
+	)
+	typ := dest.Type().Elem()
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		y := make([]int64, maxLen)
+		for i := 0; i < n; i++ {
+			if e := dest.Index(i); e.CanInt() {
+				y[i] = e.Int()
+			} else if u := e.Uint(); u <= math.MaxInt64 {
+				y[i] = int64(u)
+			} else {
+				return fmt.Errorf("BindName(%s): element %d: %d overflows int64", name, i, u)
+			}
+		}
+		stmt.keep = append(stmt.keep, y)
+		ok = C.OCI_BindArrayOfBigInts(h, nm, (*C.big_int)(unsafe.Pointer(&y[0])), C.uint(maxLen))
+		get = func(i int) reflect.Value { return reflect.ValueOf(y[i]) }
+	case reflect.Float32, reflect.Float64:
+		y := make([]float64, maxLen)
+		for i := 0; i < n; i++ {
+			y[i] = dest.Index(i).Float()
+		}
+		stmt.keep = append(stmt.keep, y)
+		ok = C.OCI_BindArrayOfDoubles(h, nm, (*C.double)(unsafe.Pointer(&y[0])), C.uint(maxLen))
+		get = func(i int) reflect.Value { return reflect.ValueOf(y[i]) }
+	case reflect.String:
+		size := arr.Size
+		if size <= 0 {
+			size = defaultOutSize
+		}
+		for i := 0; i < n; i++ {
+			if m := dest.Index(i).Len(); m > size {
+				size = m
+			}
+		}
+		y := make([]byte, (size+1)*maxLen)
+		for i := 0; i < n; i++ {
+			copy(y[i*(size+1):i*(size+1)+size], dest.Index(i).String())
+		}
+		stmt.keep = append(stmt.keep, y)
+		ok = C.OCI_BindArrayOfStrings(h, nm, (*C.dtext)(unsafe.Pointer(&y[0])), C.uint(size), C.uint(maxLen))
+		get = func(i int) reflect.Value {
+			b := y[i*(size+1) : (i+1)*(size+1)]
+			if j := bytes.IndexByte(b, 0); j >= 0 {
+				b = b[:j]
+			}
+			return reflect.ValueOf(string(b))
+		}
+	default:
+		return fmt.Errorf("BindName(%s): unsupported PLSQLArray element type %s", name, typ)
+	}
+	if ok != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+
+	bnd := C.OCI_GetBind2(h, nm)
+	dir := C.uint(C.OCI_BDM_IN)
+	if out {
+		dir = C.OCI_BDM_OUT
+		if arr.In {
+			dir = C.OCI_BDM_IN_OUT
+		}
+	}
+	if C.OCI_BindSetDirection(bnd, dir) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	// OCILIB sends all the maxLen elements by default
+	C.bindSetCount(bnd, C.uint(n))
+	if !out {
+		return nil
+	}
+
+	stmt.outs = append(stmt.outs, func() error {
+		m := int(C.bindGetCount(bnd))
+		if m > maxLen {
+			m = maxLen
+		}
+		s := reflect.MakeSlice(dest.Type(), m, m)
+		for i := 0; i < m; i++ {
+			if C.OCI_BindIsNullAtPos(bnd, C.uint(i+1)) == C.TRUE {
+				continue
+			}
+			v := get(i)
+			if v.Kind() == reflect.Int64 && overflows(s.Index(i), v.Int()) {
+				return fmt.Errorf("%s: element %d: %d overflows %s", name, i, v.Int(), typ)
+			}
+			s.Index(i).Set(v.Convert(typ))
+		}
+		dest.Set(s)
+		return nil
+	})
+	return nil
+}
+
+// overflows reports whether i does not fit in the integer v.
+func overflows(v reflect.Value, i int64) bool {
+	if v.CanUint() {
+		return i < 0 || v.OverflowUint(uint64(i))
+	}
+	return v.OverflowInt(i)
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// PoolType is the type of the pool: connection or session pooling.
+type PoolType uint
+
+const (
+	// ConnectionPool pools physical connections, sessions are created on them.
+	ConnectionPool = PoolType(C.OCI_POOL_CONNECTION)
+	// SessionPool pools stateless sessions.
+	SessionPool = PoolType(C.OCI_POOL_SESSION)
+)
+
+// ErrPoolClosed is returned by Pool.Get after the pool has been closed.
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolParams holds the parameters for NewPool.
+type PoolParams struct {
+	// Type is the pool type, ConnectionPool or SessionPool.
+	Type PoolType
+
+	// Min, Max and Increment are the minimum, maximum and the increment
+	// number of connections/sessions held in the pool.
+	// Max must be positive, Min defaults to 0 and Increment to 1.
+	Min, Max, Increment uint
+
+	// IdleTimeout is the time after the idle connections/sessions are closed.
+	// Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// NoWait makes Get return an error immediately when the pool is exhausted,
+	// instead of waiting for a free connection/session till its ctx is done.
+	NoWait bool
+
+	// InitCmds are executed, and then OnConnect is called (if not nil)
+	// on each connection got from the pool.
+	InitCmds  []string
+	OnConnect func(*Connection) error
+
+	// Tracer traces the connections got from the pool; nil means DefaultTracer.
+	Tracer Tracer
+}
+
+// PoolStats holds the pool statistics.
+type PoolStats struct {
+	// Busy is the number of connections/sessions checked out of the pool.
+	Busy uint
+	// Open is the number of connections/sessions opened by the pool.
+	Open uint
+}
+
+// Pool holds an OCI_Pool: a connection or session pool.
+type Pool struct {
+	handle    *C.OCI_Pool
+	initCmds  []string
+	onConnect func(*Connection) error
+	tracer    Tracer
+	target    string // user@sid, for tracing
+	noWait    bool
+	// released is signaled when a connection is returned to the pool.
+	released chan struct{}
+}
+
+// poolRetryInterval is the time Get waits for a returned connection before
+// it tries the pool again (as the connections/sessions can be freed by the pool, too).
+const poolRetryInterval = 100 * time.Millisecond
+
+// NewPool creates a new connection/session pool.
+// user, passwd, sid can be extracted from a user/passwd@sid text with SplitDSN.
+func NewPool(user, passwd, sid string, params PoolParams) (*Pool, error) {
+	if params.Max == 0 {
+		return nil, errors.New("NewPool: Max must be positive")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	initialize()
+	if params.Type == 0 {
+		params.Type = SessionPool
+	}
+	if params.Min > params.Max {
+		params.Min = params.Max
+	}
+	if params.Increment == 0 {
+		params.Increment = 1
+	}
+	Csid, Cuser, Cpasswd := C.CString(sid), C.CString(user), C.CString(passwd)
+	defer func() {
+		C.free(unsafe.Pointer(Csid))
+		C.free(unsafe.Pointer(Cuser))
+		C.free(unsafe.Pointer(Cpasswd))
+	}()
+	pool := Pool{
+		handle: C.OCI_PoolCreate(Csid, Cuser, Cpasswd,
+			C.uint(params.Type), C.OCI_SESSION_DEFAULT,
+			C.uint(params.Min), C.uint(params.Max), C.uint(params.Increment)),
+		initCmds:  params.InitCmds,
+		onConnect: params.OnConnect,
+		tracer:    params.Tracer,
+		target:    user + "@" + sid,
+		noWait:    params.NoWait,
+		released:  make(chan struct{}, 1),
+	}
+	if pool.handle == nil {
+		return nil, getLastErr()
+	}
+	if params.IdleTimeout > 0 {
+		if C.OCI_PoolSetTimeout(pool.handle, C.uint(params.IdleTimeout/time.Second)) != C.TRUE {
+			err := getLastErr()
+			pool.Close()
+			return nil, err
+		}
+	}
+	// OCILIB cannot stop waiting for a connection/session, so Get waits itself
+	if C.OCI_PoolSetNoWait(pool.handle, C.TRUE) != C.TRUE {
+		err := getLastErr()
+		pool.Close()
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// Get returns a connection from the pool.
+// Closing the returned connection returns it to the pool.
+//
+// If the pool is exhausted, Get waits for a free connection till the ctx is done,
+// and returns ctx.Err() then; with NoWait it returns the pool's error at once.
+func (pool *Pool) Get(ctx context.Context) (*Connection, error) {
+	if pool == nil || pool.handle == nil {
+		return nil, ErrPoolClosed
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		conn, err := pool.get()
+		if err == nil || pool.noWait || !isPoolExhausted(err) {
+			return conn, err
+		}
+		timer := time.NewTimer(poolRetryInterval)
+		select {
+		case <-ctx.Done():
+		case <-pool.released:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// get gets a connection from the OCILIB pool, which does not wait (see NewPool),
+// and initializes its session.
+func (pool *Pool) get() (*Connection, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if pool.handle == nil {
+		return nil, ErrPoolClosed
+	}
+	start := time.Now()
+	conn := Connection{handle: C.OCI_PoolGetConnection(pool.handle, nil), pool: pool, tracer: pool.tracer}
+	if conn.handle == nil {
+		err := getLastErr()
+		conn.trace(TraceEvent{Kind: TraceConnect, Target: pool.target, Duration: time.Since(start), Err: err})
+		return nil, err
+	}
+	conn.trace(TraceEvent{Kind: TraceConnect, Target: pool.target, Duration: time.Since(start)})
+	if err := conn.SetAutoCommit(false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.InitSession(pool.initCmds, pool.onConnect); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("init session: %w", err)
+	}
+	return &conn, nil
+}
+
+// release signals a waiting Get that a connection has been returned to the pool.
+func (pool *Pool) release() {
+	select {
+	case pool.released <- struct{}{}:
+	default:
+	}
+}
+
+// isPoolExhausted reports whether err is the error of a NOWAIT pool without
+// a free connection (ORA-24401) or session (ORA-24418).
+func isPoolExhausted(err error) bool {
+	e, ok := AsError(err)
+	return ok && (e.Code == 24401 || e.Code == 24418)
+}
+
+// Stats returns the current number of busy and opened connections/sessions.
+func (pool *Pool) Stats() PoolStats {
+	if pool == nil || pool.handle == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Busy: uint(C.OCI_PoolGetBusyCount(pool.handle)),
+		Open: uint(C.OCI_PoolGetOpenedCount(pool.handle)),
+	}
+}
+
+// Close destroys the pool, closing all of its connections/sessions.
+func (pool *Pool) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if pool == nil || pool.handle == nil {
+		return nil
+	}
+	var err error
+	if C.OCI_PoolFree(pool.handle) != C.TRUE {
+		err = fmt.Errorf("error closing pool %p: %v", pool.handle, getLastErr())
+	}
+	pool.handle = nil
+	return err
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolMax(t *testing.T) {
+	if _, err := NewPool("user", "passwd", "sid", PoolParams{}); err == nil {
+		t.Error("created a pool with Max 0")
+	}
+}
+
+func TestPool(t *testing.T) {
+	if *fDsn == "" {
+		t.Skip("no -dsn given")
+	}
+	user, passwd, sid := SplitDSN(*fDsn)
+	pool, err := NewPool(user, passwd, sid, PoolParams{
+		Max: 2, NoWait: true,
+		InitCmds: []string{"ALTER SESSION SET NLS_DATE_FORMAT = 'YYYY-MM-DD'"},
+	})
+	if err != nil {
+		t.Fatalf("error creating pool for %q: %s", *fDsn, err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	c1, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3, err := pool.Get(ctx); err == nil {
+		c3.Close()
+		t.Error("got a third connection from a pool of two, with NoWait")
+	}
+	if stats := pool.Stats(); stats.Busy != 2 {
+		t.Errorf("got %+v, wanted 2 busy", stats)
+	}
+	row := queryRow(t, c1, "SELECT value FROM nls_session_parameters WHERE parameter = 'NLS_DATE_FORMAT'")
+	if row[0] != "YYYY-MM-DD" {
+		t.Errorf("InitCmds have not been run: got NLS_DATE_FORMAT %v", row[0])
+	}
+
+	if err = c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := pool.Stats(); stats.Busy != 1 {
+		t.Errorf("got %+v after Close, wanted 1 busy", stats)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = pool.Get(cctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wanted context.Canceled, got %v", err)
+	}
+
+	c1.Close()
+	if err = pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.Get(ctx); err != ErrPoolClosed {
+		t.Errorf("wanted ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolWait(t *testing.T) {
+	if *fDsn == "" {
+		t.Skip("no -dsn given")
+	}
+	user, passwd, sid := SplitDSN(*fDsn)
+	pool, err := NewPool(user, passwd, sid, PoolParams{Max: 1})
+	if err != nil {
+		t.Fatalf("error creating pool for %q: %s", *fDsn, err)
+	}
+	defer pool.Close()
+
+	c1, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pool is exhausted: Get waits till its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if c2, err := pool.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		if c2 != nil {
+			c2.Close()
+		}
+		t.Errorf("wanted DeadlineExceeded, got %v", err)
+	}
+
+	// and gets the connection returned meanwhile
+	time.AfterFunc(100*time.Millisecond, func() { c1.Close() })
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c2, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.Close()
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// ErrNoMessage is returned by Dequeue when no message is available in the wait time.
+var ErrNoMessage = errors.New("no message")
+
+// Visibility says whether the enqueue/dequeue is part of the current transaction.
+type Visibility uint
+
+const (
+	// VisibleOnCommit makes the enqueue/dequeue part of the current transaction (default).
+	VisibleOnCommit = Visibility(C.OCI_AMV_ON_COMMIT)
+	// VisibleImmediate makes the enqueue/dequeue an autonomous transaction.
+	VisibleImmediate = Visibility(C.OCI_AMV_IMMEDIATE)
+)
+
+// DeqMode is the dequeue mode.
+type DeqMode uint
+
+const (
+	// DeqRemove reads and deletes the message (default).
+	DeqRemove = DeqMode(C.OCI_ADM_REMOVE)
+	// DeqBrowse reads the message without locking it.
+	DeqBrowse = DeqMode(C.OCI_ADM_BROWSE)
+	// DeqLocked reads and locks the message.
+	DeqLocked = DeqMode(C.OCI_ADM_LOCKED)
+	// DeqRemoveNoData deletes the message without reading its payload.
+	DeqRemoveNoData = DeqMode(C.OCI_ADM_REMOVE_NODATA)
+)
+
+// Navigation is the position of the message to be dequeued.
+type Navigation uint
+
+const (
+	// NavNextMsg retrieves the next message (default).
+	NavNextMsg = Navigation(C.OCI_ADN_NEXT_MSG)
+	// NavFirstMsg retrieves the first message, resetting the position.
+	NavFirstMsg = Navigation(C.OCI_ADN_FIRST_MSG)
+	// NavNextTransaction skips the rest of the current transaction group.
+	NavNextTransaction = Navigation(C.OCI_ADN_NEXT_TRANSACTION)
+)
+
+// MessageState is the state of a dequeued message.
+type MessageState uint
+
+const (
+	MsgReady     = MessageState(C.OCI_AMS_READY)
+	MsgWaiting   = MessageState(C.OCI_AMS_WAITING)
+	MsgProcessed = MessageState(C.OCI_AMS_PROCESSED)
+	MsgExpired   = MessageState(C.OCI_AMS_EXPIRED)
+)
+
+// Message is an AQ message.
+type Message struct {
+	// Raw is the payload of a RAW queue.
+	Raw []byte
+	// Object is the payload of an object queue.
+	// A dequeued Object is valid only till the next Dequeue.
+	Object *Object
+
+	Correlation    string
+	Priority       int
+	ExceptionQueue string
+	// Delay is the time the message is not available for dequeuing after the enqueue.
+	Delay time.Duration
+	// Expiration is the time the message is available for dequeuing after the Delay.
+	// Zero means never expires.
+	Expiration time.Duration
+	// Consumers is the list of recipients, overriding the queue's subscribers.
+	Consumers []string
+
+	// These are set by Dequeue.
+	ID          []byte
+	State       MessageState
+	Attempts    int
+	EnqueueTime time.Time
+}
+
+// DeqOptions are the options of Dequeue.
+type DeqOptions struct {
+	// Consumer is the name of the consumer, for multi-consumer queues.
+	Consumer string
+	// Correlation is the correlation id pattern (with % and _ wildcards).
+	Correlation string
+	Mode        DeqMode
+	Navigation  Navigation
+	Visibility  Visibility
+	// Wait is the time to wait for a message: zero means no wait,
+	// a negative value means waiting till the ctx is done.
+	// Oracle waits in whole seconds, so it is rounded up.
+	Wait time.Duration
+}
+
+// Queue is an Oracle Advanced Queue.
+type Queue struct {
+	// EnqueueVisibility is the visibility of the Enqueues.
+	EnqueueVisibility Visibility
+
+	conn     *Connection
+	name     string
+	raw      bool
+	typeInfo *C.OCI_TypeInfo
+	enq      *C.OCI_Enqueue
+	deq      *C.OCI_Dequeue
+}
+
+// NewQueue returns the named queue with the given payload type.
+// payloadType is the name of the payload object type, or "RAW" (or empty) for RAW queues.
+func (conn *Connection) NewQueue(name, payloadType string) (*Queue, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	raw := payloadType == "" || strings.ToUpper(payloadType) == "RAW"
+	if raw {
+		payloadType = "SYS.RAW"
+	}
+	Ctyp := C.CString(payloadType)
+	defer C.free(unsafe.Pointer(Ctyp))
+	q := Queue{conn: conn, name: name, raw: raw,
+		typeInfo: C.OCI_TypeInfoGet(conn.handle, Ctyp, C.OCI_TIF_TYPE)}
+	if q.typeInfo == nil {
+		return nil, getLastErr()
+	}
+	return &q, nil
+}
+
+// Enqueue puts the message into the queue.
+func (q *Queue) Enqueue(msg Message) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if q.enq == nil {
+		Cname := C.CString(q.name)
+		q.enq = C.OCI_EnqueueCreate(q.typeInfo, Cname)
+		C.free(unsafe.Pointer(Cname))
+		if q.enq == nil {
+			return getLastErr()
+		}
+	}
+	if q.EnqueueVisibility != 0 {
+		if C.OCI_EnqueueSetVisibility(q.enq, C.uint(q.EnqueueVisibility)) != C.TRUE {
+			return getLastErr()
+		}
+	}
+
+	m := C.OCI_MsgCreate(q.typeInfo)
+	if m == nil {
+		return getLastErr()
+	}
+	defer C.OCI_MsgFree(m)
+	if !q.raw {
+		if msg.Object == nil {
+			return errors.New("Enqueue: nil Object payload")
+		}
+		if C.OCI_MsgSetObject(m, msg.Object.handle) != C.TRUE {
+			return getLastErr()
+		}
+	} else {
+		var p unsafe.Pointer
+		if len(msg.Raw) > 0 {
+			p = C.CBytes(msg.Raw)
+			defer C.free(p)
+		}
+		if C.OCI_MsgSetRaw(m, p, C.uint(len(msg.Raw))) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if msg.Correlation != "" {
+		Ccorr := C.CString(msg.Correlation)
+		defer C.free(unsafe.Pointer(Ccorr))
+		if C.OCI_MsgSetCorrelation(m, Ccorr) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if msg.ExceptionQueue != "" {
+		Cexc := C.CString(msg.ExceptionQueue)
+		defer C.free(unsafe.Pointer(Cexc))
+		if C.OCI_MsgSetExceptionQueue(m, Cexc) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if msg.Priority != 0 {
+		if C.OCI_MsgSetPriority(m, C.int(msg.Priority)) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if msg.Delay > 0 {
+		if C.OCI_MsgSetEnqueueDelay(m, C.int(msg.Delay/time.Second)) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if msg.Expiration > 0 {
+		if C.OCI_MsgSetExpiration(m, C.int(msg.Expiration/time.Second)) != C.TRUE {
+			return getLastErr()
+		}
+	}
+	if len(msg.Consumers) > 0 {
+		agents := make([]*C.OCI_Agent, 0, len(msg.Consumers))
+		defer func() {
+			for _, a := range agents {
+				C.OCI_AgentFree(a)
+			}
+		}()
+		for _, name := range msg.Consumers {
+			Cname := C.CString(name)
+			a := C.OCI_AgentCreate(q.conn.handle, Cname, nil)
+			C.free(unsafe.Pointer(Cname))
+			if a == nil {
+				return getLastErr()
+			}
+			agents = append(agents, a)
+		}
+		Cagents := (**C.OCI_Agent)(C.malloc(C.size_t(len(agents)) * C.size_t(unsafe.Sizeof(agents[0]))))
+		defer C.free(unsafe.Pointer(Cagents))
+		copy(unsafe.Slice(Cagents, len(agents)), agents)
+		if C.OCI_MsgSetConsumers(m, Cagents, C.uint(len(agents))) != C.TRUE {
+			return getLastErr()
+		}
+	}
+
+	if C.OCI_EnqueuePut(q.enq, m) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Dequeue gets a message from the queue.
+// It returns ErrNoMessage if no message arrived in opts.Wait time.
+//
+// The wait is shortened to the ctx's deadline (rounded up to whole seconds),
+// and the call is broken with OCI_Break when the ctx is done.
+func (q *Queue) Dequeue(ctx context.Context, opts DeqOptions) (*Message, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if q.deq == nil {
+		Cname := C.CString(q.name)
+		q.deq = C.OCI_DequeueCreate(q.typeInfo, Cname)
+		C.free(unsafe.Pointer(Cname))
+		if q.deq == nil {
+			return nil, getLastErr()
+		}
+	}
+
+	wait := -1
+	if opts.Wait >= 0 {
+		wait = waitSeconds(opts.Wait)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := waitSeconds(time.Until(deadline)); wait < 0 || d < wait {
+			wait = d
+		}
+	}
+	if C.OCI_DequeueSetWaitTime(q.deq, C.int(wait)) != C.TRUE {
+		return nil, getLastErr()
+	}
+	// the dequeue options persist between the calls, so the empty ones are reset to NULL
+	var Ccons, Ccorr *C.char
+	if opts.Consumer != "" {
+		Ccons = C.CString(opts.Consumer)
+		defer C.free(unsafe.Pointer(Ccons))
+	}
+	if opts.Correlation != "" {
+		Ccorr = C.CString(opts.Correlation)
+		defer C.free(unsafe.Pointer(Ccorr))
+	}
+	if C.OCI_DequeueSetConsumer(q.deq, Ccons) != C.TRUE {
+		return nil, getLastErr()
+	}
+	if C.OCI_DequeueSetCorrelation(q.deq, Ccorr) != C.TRUE {
+		return nil, getLastErr()
+	}
+	if opts.Mode == 0 {
+		opts.Mode = DeqRemove
+	}
+	if C.OCI_DequeueSetMode(q.deq, C.uint(opts.Mode)) != C.TRUE {
+		return nil, getLastErr()
+	}
+	if opts.Navigation == 0 {
+		opts.Navigation = NavNextMsg
+	}
+	if C.OCI_DequeueSetNavigation(q.deq, C.uint(opts.Navigation)) != C.TRUE {
+		return nil, getLastErr()
+	}
+	if opts.Visibility == 0 {
+		opts.Visibility = VisibleOnCommit
+	}
+	if C.OCI_DequeueSetVisibility(q.deq, C.uint(opts.Visibility)) != C.TRUE {
+		return nil, getLastErr()
+	}
+
+	stop := watchBreak(ctx, q.conn.handle)
+	m := C.OCI_DequeueGet(q.deq)
+	var err error
+	if m == nil {
+		err = getLastErr()
+	}
+	if err = stop(err); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrNoMessage
+	}
+
+	msg := Message{
+		Correlation: C.GoString(C.OCI_MsgGetCorrelation(m)),
+		Priority:    int(C.OCI_MsgGetPriority(m)),
+		State:       MessageState(C.OCI_MsgGetState(m)),
+		Attempts:    int(C.OCI_MsgGetAttemptCount(m)),
+		Delay:       time.Duration(C.OCI_MsgGetEnqueueDelay(m)) * time.Second,
+	}
+	if exp := int(C.OCI_MsgGetExpiration(m)); exp > 0 {
+		msg.Expiration = time.Duration(exp) * time.Second
+	}
+	if s := C.OCI_MsgGetExceptionQueue(m); s != nil {
+		msg.ExceptionQueue = C.GoString(s)
+	}
+	if od := C.OCI_MsgGetEnqueueTime(m); od != nil {
+		if msg.EnqueueTime, err = ociDateToTime(od); err != nil {
+			return nil, err
+		}
+	}
+	id := make([]byte, 64)
+	idLen := C.uint(len(id))
+	if C.OCI_MsgGetID(m, unsafe.Pointer(&id[0]), &idLen) == C.TRUE {
+		msg.ID = id[:idLen]
+	}
+	if opts.Mode == DeqRemoveNoData {
+		return &msg, nil
+	}
+	if !q.raw {
+		if obj := C.OCI_MsgGetObject(m); obj != nil {
+			msg.Object = &Object{handle: obj}
+		}
+	} else {
+		raw := make([]byte, 32767)
+		rawLen := C.uint(len(raw))
+		if C.OCI_MsgGetRaw(m, unsafe.Pointer(&raw[0]), &rawLen) != C.TRUE {
+			return nil, getLastErr()
+		}
+		msg.Raw = raw[:rawLen]
+	}
+	return &msg, nil
+}
+
+// Close frees the enqueue and dequeue handles of the queue.
+func (q *Queue) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var err error
+	if q.enq != nil {
+		if C.OCI_EnqueueFree(q.enq) != C.TRUE {
+			err = getLastErr()
+		}
+		q.enq = nil
+	}
+	if q.deq != nil {
+		if C.OCI_DequeueFree(q.deq) != C.TRUE && err == nil {
+			err = getLastErr()
+		}
+		q.deq = nil
+	}
+	return err
+}
+
+// waitSeconds returns d in whole seconds for OCI_DequeueSetWaitTime, rounded up.
+func waitSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
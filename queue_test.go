@@ -0,0 +1,74 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	cx, st := testStatement(t)
+	testObject(t, st, `BEGIN
+  DBMS_AQADM.CREATE_QUEUE_TABLE('tst_gocilib_q_t', 'RAW');
+  DBMS_AQADM.CREATE_QUEUE('tst_gocilib_q', 'tst_gocilib_q_t');
+  DBMS_AQADM.START_QUEUE('tst_gocilib_q');
+END;`,
+		"BEGIN DBMS_AQADM.DROP_QUEUE_TABLE('tst_gocilib_q_t', TRUE); END;")
+
+	q, err := cx.NewQueue("tst_gocilib_q", "RAW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	want := []byte("árvíztűrő\x00\xff")
+	if err = q.Enqueue(Message{Raw: want, Correlation: "gocilib", Priority: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err = cx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := q.Dequeue(context.Background(), DeqOptions{Wait: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Raw, want) || msg.Correlation != "gocilib" || msg.Priority != 2 || len(msg.ID) == 0 {
+		t.Errorf("got %+v", msg)
+	}
+	if err = cx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is empty now
+	if _, err = q.Dequeue(context.Background(), DeqOptions{Wait: 0}); err != ErrNoMessage {
+		t.Errorf("wanted ErrNoMessage, got %v", err)
+	}
+	// an indefinite wait is cut by the ctx
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err = q.Dequeue(ctx, DeqOptions{Wait: -1}); err != ErrNoMessage && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wanted ErrNoMessage or DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("the dequeue waited %s", d)
+	}
+}
@@ -16,46 +16,92 @@ limitations under the License.
 
 package gocilib
 
-// #cgo LDFLAGS: -locilib
-// #include "ocilib.h"
+// #include <string.h>
+// #include "ocilib_internal.h"
+//
+// /* wraps the implicit result's handle (owned by the parent statement) as
+//    OCI_GetStatement wraps the ref cursor columns': as a fetched, executed SELECT */
+// static OCI_Statement *implicitStatement(OCI_Connection *con, void *handle) {
+//     OCI_Statement *st = NULL;
+//     OCI_Define def;
+//     memset(&def, 0, sizeof(def));
+//     return OCI_StatementInit(con, &st, (OCIStmt *)handle, &def);
+// }
+// /* as OCI_ResultsetFree frees the ref cursor columns' statements */
+// static void implicitFree(OCI_Statement *st) { OCI_StatementClose(st); OCI_MemFree(st); }
 import "C"
 
 import (
-	"bytes"
+	"context"
 	"database/sql/driver"
 	"fmt"
 	"io"
 	"math/big"
 	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
 )
 
-//UseBigInt shall be true for returning big.Ints
-var UseBigInt = false
-
 var zeroTime time.Time
 
 func (stmt *Statement) Results() (*Resultset, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	rs := C.OCI_GetResultset(stmt.handle)
 	if rs == nil {
 		return &Resultset{stmt: stmt}, getLastErr()
 	}
-	return &Resultset{handle: rs, stmt: stmt}, nil
+	return &Resultset{handle: rs, stmt: stmt, start: time.Now()}, nil
 }
 
 type Resultset struct {
 	handle *C.OCI_Resultset
 	stmt   *Statement
 	cols   []ColDesc
+	owned  bool // the statement is closed with the resultset
+
+	start  time.Time // for tracing the fetch
+	traced bool
 }
 
-// Next advances to the next record, and returns io.EOF at the end.
+// Next advances to the next record, and returns io.EOF at the end
+// (immediately for the statements without a resultset).
 func (rs *Resultset) Next() error {
-	if C.OCI_FetchNext(rs.handle) != C.TRUE {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if rs.handle == nil {
+		return io.EOF
+	}
+	err := fetchResult(C.OCI_FetchNext(rs.handle))
+	if err != nil {
+		rs.traceFetch(err)
+	}
+	return err
+}
+
+// traceFetch sends the TraceFetch event once, at the end of the fetch,
+// or at the Close of a resultset that has not been fetched to its end.
+func (rs *Resultset) traceFetch(err error) {
+	if rs.traced || rs.handle == nil {
+		return
+	}
+	rs.traced = true
+	ev := TraceEvent{Kind: TraceFetch, SQL: rs.stmt.statement,
+		Duration: time.Since(rs.start), Rows: int64(C.OCI_GetRowCount(rs.handle))}
+	if err != io.EOF {
+		ev.Err = err
+	}
+	rs.stmt.trace(ev)
+}
+
+// fetchResult returns io.EOF if the fetch has found no row, or the error.
+func fetchResult(ok C.int) error {
+	if ok != C.TRUE {
 		err := getLastErr()
-		if err != nil && err.(*Error).Code != 0 {
+		if err != nil {
 			return err
 		}
 		return io.EOF
@@ -63,11 +109,157 @@ func (rs *Resultset) Next() error {
 	return nil
 }
 
+// Prev moves to the previous record of a scrollable resultset,
+// and returns io.EOF before the first one.
+func (rs *Resultset) Prev() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return fetchResult(C.OCI_FetchPrev(rs.handle))
+}
+
+// First moves to the first record of a scrollable resultset,
+// and returns io.EOF if the resultset is empty.
+func (rs *Resultset) First() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return fetchResult(C.OCI_FetchFirst(rs.handle))
+}
+
+// Last moves to the last record of a scrollable resultset,
+// and returns io.EOF if the resultset is empty.
+func (rs *Resultset) Last() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return fetchResult(C.OCI_FetchLast(rs.handle))
+}
+
+// Seek moves to the record of a scrollable resultset at offset,
+// relative to the first row (io.SeekStart), the current row (io.SeekCurrent)
+// or the last row (io.SeekEnd), and returns the new row index (see CurrentRow).
+//
+// Returns io.EOF if there is no such row.
+func (rs *Resultset) Seek(offset int64, whence int) (int64, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var err error
+	switch whence {
+	case io.SeekStart:
+		if offset < 0 {
+			return rs.CurrentRow(), io.EOF
+		}
+		err = fetchResult(C.OCI_FetchSeek(rs.handle, C.OCI_SFD_ABSOLUTE, C.int(offset+1)))
+	case io.SeekCurrent:
+		err = fetchResult(C.OCI_FetchSeek(rs.handle, C.OCI_SFD_RELATIVE, C.int(offset)))
+	case io.SeekEnd:
+		if err = rs.Last(); err == nil && offset != 0 {
+			err = fetchResult(C.OCI_FetchSeek(rs.handle, C.OCI_SFD_RELATIVE, C.int(offset)))
+		}
+	default:
+		return rs.CurrentRow(), fmt.Errorf("Seek: unknown whence %d", whence)
+	}
+	return rs.CurrentRow(), err
+}
+
+// CurrentRow returns the 0-based index of the current row,
+// or -1 if no row has been fetched.
+func (rs *Resultset) CurrentRow() int64 {
+	return int64(C.OCI_GetCurrentRow(rs.handle)) - 1
+}
+
+// NextContext is like Next, but breaks the fetch with OCI_Break
+// when the ctx is done.
+func (rs *Resultset) NextContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := rs.stmt.watchContext(ctx)
+	return stop(rs.Next())
+}
+
+// Close closes the resultset, and the ref cursor's statement
+// if the resultset has been returned by an Out bind.
 func (rs *Resultset) Close() error {
+	rs.traceFetch(nil)
 	rs.handle = nil
+	if rs.owned && rs.stmt != nil {
+		rs.owned = false
+		return rs.stmt.Close()
+	}
 	return nil
 }
 
+// Statement returns the statement of the resultset.
+func (rs *Resultset) Statement() *Statement {
+	return rs.stmt
+}
+
+// cursor returns the resultset of the ref cursor statement handle,
+// with the fetch settings of stmt.
+func (stmt *Statement) cursor(handle *C.OCI_Statement) (*Resultset, error) {
+	cur := Statement{handle: handle, verb: "SELECT",
+		PrefetchMemory: defaultPrefetchMemory, FetchSize: defaultFetchSize}
+	if stmt != nil {
+		cur.conn = stmt.conn
+		cur.PrefetchMemory, cur.FetchSize = stmt.PrefetchMemory, stmt.FetchSize
+		cur.NumberMode = stmt.NumberMode
+	}
+	if err := cur.setFetchSizes(); err != nil {
+		return nil, err
+	}
+	return cur.Results()
+}
+
+// NextResultset returns the next resultset of the executed statement, or io.EOF:
+// of a DML statement with a RETURNING INTO clause executed with array binds,
+// or the next implicit result (DBMS_SQL.RETURN_RESULT, since Oracle 12c)
+// of a PL/SQL block.
+//
+// The implicit results belong to the statement: they are valid
+// till its next execution or Close.
+func (stmt *Statement) NextResultset() (*Resultset, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// OCI_GetNextResultset is safe only if the statement has resultsets at all
+	if C.OCI_GetResultset(stmt.handle) == nil {
+		return stmt.nextImplicit()
+	}
+	rs := C.OCI_GetNextResultset(stmt.handle)
+	if rs == nil {
+		if err := getLastErr(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return &Resultset{handle: rs, stmt: stmt, start: time.Now()}, nil
+}
+
+// nextImplicit returns the next implicit result of the executed statement,
+// wrapped as a ref cursor, or io.EOF.
+func (stmt *Statement) nextImplicit() (*Resultset, error) {
+	con := C.OCI_StatementGetConnection(stmt.handle)
+	handle, err := stmtNextResult(C.OCI_HandleGetStatement(stmt.handle), C.OCI_HandleGetError(con))
+	if err != nil {
+		return nil, err
+	}
+	if handle == nil {
+		return nil, io.EOF
+	}
+	st := C.implicitStatement(con, handle)
+	if st == nil {
+		return nil, getLastErr()
+	}
+	stmt.implicit = append(stmt.implicit, st)
+	return stmt.cursor(st)
+}
+
+// freeImplicit frees the wrappers of the implicit results got by NextResultset.
+func (stmt *Statement) freeImplicit() {
+	for _, st := range stmt.implicit {
+		C.implicitFree(st)
+	}
+	stmt.implicit = stmt.implicit[:0]
+}
+
 func (rs *Resultset) RowsAffected() int64 {
 	return rs.stmt.RowsAffected()
 }
@@ -78,8 +270,13 @@ func (rs *Resultset) FetchInto(row []driver.Value) error {
 	var err error
 	for i, v := range row {
 		ui := C.uint(i + 1)
-		Log.Debug("FetchInto", "i", i, "v", fmt.Sprintf("%#v (%T)", v, v))
 		isNull := C.OCI_IsNull(rs.handle, ui) == C.TRUE
+		if cols[i].Type == ColLob && !isNull {
+			if err = fetchLob(row, i, C.OCI_GetLob(rs.handle, ui)); err != nil {
+				break
+			}
+			continue
+		}
 		switch x := v.(type) {
 		case int:
 			if isNull {
@@ -160,12 +357,38 @@ func (rs *Resultset) FetchInto(row []driver.Value) error {
 				row[i] = zeroTime
 				continue
 			}
-			row[i], err = ociDateToTime(C.OCI_GetDate(rs.handle, ui))
+			row[i], err = rs.timeAt(ui)
 		case *time.Time:
 			if isNull {
 				row[i] = nil
 			} else {
-				*x, err = ociDateToTime(C.OCI_GetDate(rs.handle, ui))
+				*x, err = rs.timeAt(ui)
+			}
+		case Number:
+			if isNull {
+				row[i] = Number("")
+				continue
+			}
+			row[i], err = rs.numberAt(ui)
+		case *Number:
+			if isNull {
+				row[i] = nil
+			} else {
+				*x, err = rs.numberAt(ui)
+			}
+		case *big.Int:
+			var n Number
+			if isNull {
+				row[i] = nil
+			} else if n, err = rs.numberAt(ui); err == nil && !setBigInt(x, n) {
+				err = fmt.Errorf("FetchInto(%d.): %q is not an integer", i, n)
+			}
+		case *big.Rat:
+			var n Number
+			if isNull {
+				row[i] = nil
+			} else if n, err = rs.numberAt(ui); err == nil && !setBigRat(x, n) {
+				err = fmt.Errorf("FetchInto(%d.): %q is not a number", i, n)
 			}
 		default:
 			if isNull {
@@ -179,73 +402,56 @@ func (rs *Resultset) FetchInto(row []driver.Value) error {
 				ref = ref.Elem()
 				pointerOk = ref.CanSet()
 			}
-			Log.Debug("default", "Type", ref.String(), "isPointer?", isPointer, "pointerOk?", pointerOk, "kind", ref.Kind(),
-				"col.Type", cols[i].Type)
 			switch cols[i].Type {
 			case ColNumeric:
-				s := strings.Replace(C.GoString(C.OCI_GetString(rs.handle, ui)), ",", ".", 1)
+				var n Number
+				if n, err = rs.numberAt(ui); err != nil {
+					break
+				}
 				if cols[i].Precision <= 0 && cols[i].Scale <= 0 { // FIXME(tgulacsi): how can be scale=prec=0 ?
-					cols[i].Precision, cols[i].Scale = len(s), 0
-					if s[0] == '-' {
+					cols[i].Precision, cols[i].Scale = len(n), 0
+					if n[0] == '-' {
 						cols[i].Precision--
 					}
-					j := strings.IndexByte(s, '.')
+					j := strings.IndexByte(string(n), '.')
 					if j >= 0 {
 						cols[i].Precision--
-						cols[i].Scale = len(s) - 1
+						cols[i].Scale = len(n) - 1
 					}
 				}
-				Log.Debug("int", "prec", cols[i].Precision, "scale", cols[i].Scale)
-				if cols[i].Scale == 0 { // integer
-					//fmt.Printf("col[%d]=%+v\n", i, cols[i])
-					if cols[i].Precision <= 19 {
-						x := int64(C.OCI_GetBigInt(rs.handle, ui))
-						Log.Debug("ref", "ref", ref, "x", x)
-						if isPointer {
-							if !pointerOk {
-								row[i] = &x
-							} else {
-								Log.Debug("set", "x", x, "vof", reflect.ValueOf(x))
-								ref.SetInt(x)
-								Log.Debug("set", "ref", ref)
-							}
-						} else {
-							row[i] = x
-						}
+				var val interface{}
+				isInt := cols[i].Scale == 0
+				switch rs.numberMode() {
+				case NumberAsNumber:
+					val = n
+				case NumberAsBig:
+					if bi := new(big.Int); isInt && setBigInt(bi, n) {
+						val = bi
+					} else if r := new(big.Rat); setBigRat(r, n) {
+						val = r
 					} else {
-						ok := false
-						if UseBigInt {
-							row[i], ok = row[i].(*big.Int).SetString(s, 10)
-						}
-						if !ok {
-							if isPointer {
-								if pointerOk {
-									ref.Set(reflect.ValueOf(s))
-								} else {
-									row[i] = &s
-								}
-							} else {
-								row[i] = s
-							}
-						}
+						val = string(n)
 					}
-				} else {
-					ok := false
-					if UseBigInt {
-						row[i], ok = row[i].(*big.Rat).SetString(s)
+				default:
+					// the precision of the unconstrained NUMBERs is guessed from the first value
+					if j, err := strconv.ParseInt(string(n), 10, 64); isInt && err == nil {
+						val = j
+					} else {
+						val = string(n)
 					}
-					if !ok {
-						if isPointer {
-							if pointerOk {
-								ref.Set(reflect.ValueOf(x))
-							} else {
-								row[i] = &s
-							}
-						} else {
-							row[i] = s
-						}
+				}
+				if !isPointer {
+					row[i] = val
+				} else if !pointerOk {
+					p := reflect.New(reflect.TypeOf(val))
+					p.Elem().Set(reflect.ValueOf(val))
+					row[i] = p.Interface()
+				} else {
+					v := reflect.ValueOf(val)
+					if !v.Type().AssignableTo(ref.Type()) && v.Type().ConvertibleTo(ref.Type()) {
+						v = v.Convert(ref.Type())
 					}
-					//row[i] = float64(C.OCI_GetDouble(rs.handle, ui))
+					ref.Set(v)
 				}
 			case ColDate:
 				var t time.Time
@@ -272,23 +478,47 @@ func (rs *Resultset) FetchInto(row []driver.Value) error {
 					row[i] = t
 				}
 			case ColInterval:
-				var t time.Duration
-				t, err = ociIntervalToDuration(C.OCI_GetInterval(rs.handle, ui))
-				if isPointer {
-					ref.Set(reflect.ValueOf(t))
-				} else {
-					row[i] = t
-				}
+				err = fetchInterval(row, i, ref, pointerOk, C.OCI_GetInterval(rs.handle, ui))
 			case ColRaw:
 				b := make([]byte, cols[i].InternalSize)
 				n := C.OCI_GetRaw(rs.handle, ui, unsafe.Pointer(&b[0]), C.uint(cap(b)))
 				row[i] = b[:n]
 			case ColCursor:
-				st := Statement{handle: C.OCI_GetStatement(rs.handle, ui)}
-				if isPointer && pointerOk {
-					ref.Set(reflect.ValueOf(&st))
+				var cur *Resultset
+				if cur, err = rs.stmt.cursor(C.OCI_GetStatement(rs.handle, ui)); err != nil {
+					break
+				}
+				if isPointer && pointerOk && ref.Type() == reflect.TypeOf(cur) {
+					ref.Set(reflect.ValueOf(cur))
+				} else {
+					row[i] = cur
+				}
+			case ColObject:
+				obj := rs.stmt.connection().newFetchedObject(C.OCI_GetObject(rs.handle, ui))
+				obj.numberMode = rs.numberMode()
+				err = fetchObject(row, i, ref, pointerOk, obj)
+			case ColCollection:
+				co := rs.stmt.connection().newFetchedColl(C.OCI_GetColl(rs.handle, ui))
+				co.numberMode = rs.numberMode()
+				switch {
+				case isPointer && pointerOk && ref.Type() == collType:
+					ref.Set(reflect.ValueOf(*co))
+				case isPointer && pointerOk && ref.Kind() == reflect.Slice:
+					err = co.ToSlice(row[i])
+				default:
+					row[i] = co
+				}
+			case ColRef:
+				re := &Ref{handle: C.OCI_GetRef(rs.handle, ui), conn: rs.stmt.connection()}
+				if isPointer && pointerOk && ref.Kind() == reflect.Struct && ref.Type() != refType {
+					var obj *Object
+					if obj, err = re.Object(); err == nil && obj != nil {
+						err = fetchObject(row, i, ref, pointerOk, obj)
+					}
+				} else if isPointer && pointerOk && ref.Type() == refType {
+					ref.Set(reflect.ValueOf(*re))
 				} else {
-					row[i] = &st
+					row[i] = re
 				}
 			default:
 				//err = fmt.Errorf("FetchInto(%d.): unknown type %T", i, x)
@@ -302,6 +532,111 @@ func (rs *Resultset) FetchInto(row []driver.Value) error {
 	return err
 }
 
+// fetchObject sets row[i] to the object, or copies it into the *Object or
+// struct row[i] points to (ref, when pointerOk).
+func fetchObject(row []driver.Value, i int, ref reflect.Value, pointerOk bool, obj *Object) error {
+	if pointerOk {
+		switch {
+		case ref.Type() == objectType:
+			ref.Set(reflect.ValueOf(*obj))
+			return nil
+		case ref.Kind() == reflect.Struct && ref.Type() != timeType:
+			return obj.ToStruct(ref.Addr().Interface())
+		}
+	}
+	row[i] = obj
+	return nil
+}
+
+// fetchInterval sets row[i] to the interval (see ociIntervalValue),
+// or sets the *YearMonthInterval, *DaySecondInterval or *time.Duration
+// row[i] points to (ref, when pointerOk).
+func fetchInterval(row []driver.Value, i int, ref reflect.Value, pointerOk bool, oi *C.OCI_Interval) error {
+	v, err := ociIntervalValue(oi)
+	if err != nil || !pointerOk {
+		row[i] = v
+		return err
+	}
+	switch ref.Type() {
+	case daySecondType:
+		ds, err := ociIntervalToDaySecond(oi)
+		if err != nil {
+			return err
+		}
+		ref.Set(reflect.ValueOf(ds))
+		return nil
+	case yearMonthType, durationType:
+		if rv := reflect.ValueOf(v); rv.Type() == ref.Type() {
+			ref.Set(rv)
+			return nil
+		}
+		return fmt.Errorf("FetchInto(%d.): cannot fetch %T into %s", i, v, ref.Type())
+	}
+	row[i] = v
+	return nil
+}
+
+var (
+	yearMonthType = reflect.TypeOf(YearMonthInterval{})
+	daySecondType = reflect.TypeOf(DaySecondInterval{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+)
+
+// timeAt returns the DATE or TIMESTAMP column as time.Time.
+func (rs *Resultset) timeAt(ui C.uint) (time.Time, error) {
+	if ColType(C.OCI_ColumnGetType(C.OCI_GetColumn(rs.handle, ui))) == ColTimestamp {
+		return ociTimestampToTime(C.OCI_GetTimestamp(rs.handle, ui))
+	}
+	return ociDateToTime(C.OCI_GetDate(rs.handle, ui))
+}
+
+// numberMode returns the NumberMode of the statement.
+func (rs *Resultset) numberMode() NumberMode {
+	if rs.stmt == nil {
+		return NumberAuto
+	}
+	return rs.stmt.NumberMode
+}
+
+// fetchLob sets row[i] to the LOB, as a stream (for *LOB or LOB destination)
+// or fully read into a []byte or string.
+func fetchLob(row []driver.Value, i int, handle *C.OCI_Lob) error {
+	lob := &LOB{handle: handle}
+	switch x := row[i].(type) {
+	case LOB:
+		row[i] = lob
+		return nil
+	case *LOB:
+		if x == nil {
+			row[i] = lob
+		} else {
+			*x = *lob
+		}
+		return nil
+	}
+	b, err := lob.readAll()
+	if err != nil {
+		return err
+	}
+	switch x := row[i].(type) {
+	case string:
+		row[i] = string(b)
+	case *string:
+		*x = string(b)
+	case []byte:
+		row[i] = b
+	case *[]byte:
+		*x = b
+	default:
+		if lob.isBinary() {
+			row[i] = b
+		} else {
+			row[i] = string(b)
+		}
+	}
+	return nil
+}
+
 type ColType uint8
 
 const (
@@ -415,6 +750,8 @@ func stringToBool(s string) bool {
 }
 
 func ociDateToTime(od *C.OCI_Date) (time.Time, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	var t time.Time
 	var y, m, d, H, M, S C.int
 	if C.OCI_DateGetDateTime(od, &y, &m, &d, &H, &M, &S) != C.TRUE {
@@ -423,47 +760,3 @@ func ociDateToTime(od *C.OCI_Date) (time.Time, error) {
 	t = time.Date(int(y), time.Month(m), int(d), int(H), int(M), int(S), 0, time.Local)
 	return t, nil
 }
-
-func ociTimestampToTime(od *C.OCI_Timestamp) (time.Time, error) {
-	var t time.Time
-	var y, m, d, H, M, S, F, oh, om C.int
-	zone := time.Local
-	if C.OCI_TimestampGetTimeZoneOffset(od, &oh, &om) == C.TRUE {
-		var name string
-		b := make([]byte, 32)
-		if C.OCI_TimestampGetTimeZoneName(od, C.int(cap(b)), (*C.char)(unsafe.Pointer(&b[0]))) == C.TRUE {
-			i := bytes.IndexByte(b, 0)
-			if i >= 0 {
-				b = b[:i]
-			}
-			name = string(b)
-		}
-		if name == "" {
-			name = fmt.Sprintf("%d:%d", oh, om)
-		}
-		zone = time.FixedZone(name, int(oh*60+om)*60)
-	}
-	if C.OCI_TimestampGetDateTime(od, &y, &m, &d, &H, &M, &S, &F) != C.TRUE {
-		return t, getLastErr()
-	}
-	t = time.Date(int(y), time.Month(m), int(d), int(H), int(M), int(S), int(time.Duration(F)*time.Millisecond*100), zone)
-	return t, nil
-}
-
-func ociIntervalToDuration(od *C.OCI_Interval) (time.Duration, error) {
-	if C.OCI_IntervalGetType(od) == C.OCI_INTERVAL_YM {
-		var y, m C.int
-		if C.OCI_IntervalGetYearMonth(od, &y, &m) != C.TRUE {
-			return 0, getLastErr()
-		}
-		return time.Duration(y*365+m*30) * 24 * time.Hour, nil
-	}
-	var d, H, M, S, F C.int
-	if C.OCI_IntervalGetDaySecond(od, &d, &H, &M, &S, &F) != C.TRUE {
-		return 0, getLastErr()
-	}
-	return (time.Duration(d*24+H)*time.Hour +
-		time.Duration(M)*time.Minute +
-		time.Duration(S)*time.Second +
-		time.Duration(F*100)*time.Millisecond), nil
-}
@@ -0,0 +1,97 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestScrollable(t *testing.T) {
+	_, st := testStatement(t)
+	if err := st.SetScrollable(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Execute("SELECT LEVEL FROM DUAL CONNECT BY LEVEL <= 10"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := st.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if i := rs.CurrentRow(); i != -1 {
+		t.Errorf("got current row %d before the fetch, wanted -1", i)
+	}
+	row := make([]driver.Value, 1)
+	// check checks that the current row is the idx-th (0-based), which holds idx+1
+	check := func(step string, err error, idx int64) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if i := rs.CurrentRow(); i != idx {
+			t.Errorf("%s: got current row %d, wanted %d", step, i, idx)
+		}
+		if err := rs.FetchInto(row); err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if row[0] != idx+1 {
+			t.Errorf("%s: got %v, wanted %d", step, row[0], idx+1)
+		}
+	}
+
+	check("Next", rs.Next(), 0)
+	check("Next", rs.Next(), 1)
+	check("Last", rs.Last(), 9)
+	check("Prev", rs.Prev(), 8)
+	check("First", rs.First(), 0)
+	if err = rs.Prev(); err != io.EOF {
+		t.Errorf("wanted io.EOF before the first row, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{4, io.SeekStart, 4},
+		{2, io.SeekCurrent, 6},
+		{-3, io.SeekCurrent, 3},
+		{0, io.SeekEnd, 9},
+		{-2, io.SeekEnd, 7},
+	} {
+		i, err := rs.Seek(tc.offset, tc.whence)
+		if i != tc.want {
+			t.Errorf("Seek(%d, %d): got %d, wanted %d", tc.offset, tc.whence, i, tc.want)
+		}
+		check(fmt.Sprintf("Seek(%d, %d)", tc.offset, tc.whence), err, tc.want)
+	}
+	for _, whence := range []int{io.SeekStart, io.SeekEnd} {
+		if _, err = rs.Seek(10, whence); err != io.EOF {
+			t.Errorf("Seek(10, %d): wanted io.EOF, got %v", whence, err)
+		}
+	}
+	if _, err = rs.Seek(-1, io.SeekStart); err != io.EOF {
+		t.Errorf("Seek(-1, io.SeekStart): wanted io.EOF, got %v", err)
+	}
+	if _, err = rs.Seek(0, 42); err == nil {
+		t.Error("wanted error for an unknown whence")
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ScanStruct scans the current row into the struct dst points to.
+//
+// The columns are mapped to the fields by the `oracle:"COL_NAME"` tag,
+// or by the case-insensitive field name. Fields of embedded structs are
+// mapped, too; fields tagged with `oracle:"-"` and unmapped columns are skipped.
+// NULLs are returned as nil for pointer fields, and as the zero value otherwise.
+func (rs *Resultset) ScanStruct(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: dst must be a non-nil pointer to a struct, not %T", dst)
+	}
+	v = v.Elem()
+	return rs.scanStruct(v, rs.fieldMap(v.Type()))
+}
+
+// ScanAll scans all the remaining rows into the slice slicePtr points to.
+// The slice's element must be a struct or a pointer to a struct, see ScanStruct.
+func (rs *Resultset) ScanAll(slicePtr interface{}) error {
+	v := reflect.ValueOf(slicePtr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ScanAll: slicePtr must be a non-nil pointer to a slice, not %T", slicePtr)
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("ScanAll: slice element must be a struct, not %s", elemType)
+	}
+	fields := rs.fieldMap(structType)
+	for {
+		if err := rs.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		elem := reflect.New(structType)
+		if err := rs.scanStruct(elem.Elem(), fields); err != nil {
+			return err
+		}
+		if !isPtr {
+			elem = elem.Elem()
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+}
+
+// fieldMap returns the field index path for each column (nil for unmapped columns),
+// cached in the statement.
+func (rs *Resultset) fieldMap(typ reflect.Type) [][]int {
+	if rs.stmt != nil {
+		if fields, ok := rs.stmt.fieldMaps[typ]; ok {
+			return fields
+		}
+	}
+	cols := rs.Columns()
+	fields := make([][]int, len(cols))
+	byName := make(map[string][]int)
+	collectFields(typ, nil, byName, make(map[string]int))
+	for i, c := range cols {
+		fields[i] = byName[strings.ToUpper(c.Name)]
+	}
+	if rs.stmt != nil {
+		if rs.stmt.fieldMaps == nil {
+			rs.stmt.fieldMaps = make(map[reflect.Type][][]int, 1)
+		}
+		rs.stmt.fieldMaps[typ] = fields
+	}
+	return fields
+}
+
+// collectFields collects the fields of typ into byName, keyed by the upper-cased
+// column name. The shallower fields win, as with Go's field selectors.
+func collectFields(typ reflect.Type, index []int, byName map[string][]int, depths map[string]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("oracle")
+		if tag == "-" {
+			continue
+		}
+		path := append(append(make([]int, 0, len(index)+1), index...), i)
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				collectFields(ft, path, byName, depths)
+				continue
+			}
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToUpper(name)
+		if d, ok := depths[name]; ok && d <= len(path) {
+			continue
+		}
+		byName[name], depths[name] = path, len(path)
+	}
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// scanStruct fetches the current row into the fields of v.
+func (rs *Resultset) scanStruct(v reflect.Value, fields [][]int) error {
+	row := make([]driver.Value, len(fields))
+	targets := make([]reflect.Value, len(fields))
+	for i, path := range fields {
+		if path == nil {
+			continue
+		}
+		f := fieldByIndex(v, path)
+		if f.Kind() == reflect.Ptr && C.OCI_IsNull(rs.handle, C.uint(i+1)) == C.TRUE {
+			f.Set(reflect.Zero(f.Type()))
+			continue
+		}
+		targets[i] = f
+		if f.Addr().Type().Implements(scannerType) {
+			continue
+		}
+		row[i] = scanTemplate(f.Type())
+	}
+	if err := rs.FetchInto(row); err != nil {
+		return err
+	}
+	for i, f := range targets {
+		if !f.IsValid() {
+			continue
+		}
+		if err := assignAttr(f, row[i]); err != nil {
+			return fmt.Errorf("ScanStruct: column %s: %v", rs.cols[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but allocates the nil
+// embedded struct pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// scanTemplate returns the FetchInto template value for the field type.
+func scanTemplate(typ reflect.Type) driver.Value {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(0)
+	case reflect.Float32, reflect.Float64:
+		return float64(0)
+	case reflect.Bool:
+		return false
+	case reflect.String:
+		return ""
+	}
+	return nil
+}
+
+// assignValue sets f to the fetched value.
+func assignValue(f reflect.Value, value driver.Value) error {
+	if s, ok := f.Addr().Interface().(sql.Scanner); ok {
+		return s.Scan(value)
+	}
+	if f.Kind() == reflect.Ptr {
+		if value == nil {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		p := reflect.New(f.Type().Elem())
+		if err := assignValue(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	if value == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if f.Kind() == reflect.String && rv.Kind() != reflect.String && rv.Kind() != reflect.Slice {
+		f.SetString(fmt.Sprint(rv.Interface()))
+		return nil
+	}
+	if !rv.Type().ConvertibleTo(f.Type()) {
+		return fmt.Errorf("cannot assign %T to %s", value, f.Type())
+	}
+	f.Set(rv.Convert(f.Type()))
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import "testing"
+
+type testScanBase struct {
+	ID int64
+}
+
+type testScanRow struct {
+	testScanBase
+	Name    string `oracle:"FULL_NAME"`
+	Note    *string
+	Amount  float64
+	Skipped string `oracle:"-"`
+}
+
+func TestScanStruct(t *testing.T) {
+	_, st := testStatement(t)
+	if err := st.Execute(`SELECT 1 id, 'a' full_name, NULL note, 1.5 amount, 'x' skipped, 0 unmapped FROM DUAL
+UNION ALL SELECT 2, 'b', 'n', 2.25, 'y', 0 FROM DUAL
+UNION ALL SELECT 3, 'c', NULL, NULL, 'z', 0 FROM DUAL ORDER BY 1`); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := st.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if err = rs.Next(); err != nil {
+		t.Fatal(err)
+	}
+	var first testScanRow
+	if err = rs.ScanStruct(&first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || first.Name != "a" || first.Note != nil || first.Amount != 1.5 || first.Skipped != "" {
+		t.Errorf("got %+v", first)
+	}
+
+	var rest []*testScanRow
+	if err = rs.ScanAll(&rest); err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 2 {
+		t.Fatalf("got %d rows, wanted 2", len(rest))
+	}
+	if r := rest[0]; r.ID != 2 || r.Name != "b" || r.Note == nil || *r.Note != "n" || r.Amount != 2.25 {
+		t.Errorf("got %+v", r)
+	}
+	if r := rest[1]; r.ID != 3 || r.Note != nil || r.Amount != 0 || r.Skipped != "" {
+		t.Errorf("got %+v", r)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sqlparse rewrites the ?, $1 and @name placeholders of SQL statements
+// to Oracle binds, understanding Oracle's literal, quoting and comment rules.
+package sqlparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Style is the placeholder style of a statement.
+type Style uint8
+
+const (
+	// NoPlaceholders means the statement has no placeholders.
+	NoPlaceholders = Style(iota)
+	// Oracle is the native :name or :1 style.
+	Oracle
+	// Question is the ? style, numbered by occurrence.
+	Question
+	// Dollar is the $1 style.
+	Dollar
+	// At is the @name style.
+	At
+)
+
+func (s Style) String() string {
+	switch s {
+	case NoPlaceholders:
+		return "none"
+	case Oracle:
+		return ":name"
+	case Question:
+		return "?"
+	case Dollar:
+		return "$n"
+	case At:
+		return "@name"
+	}
+	return "Style(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Query is a rewritten statement.
+type Query struct {
+	// SQL is the statement with Oracle binds.
+	SQL string
+	// Names are the bind names (without the colon), in the order of their
+	// first occurrence. The ? placeholders are named "1", "2", ...
+	Names []string
+	// Style is the placeholder style of the original statement.
+	Style Style
+}
+
+// Rewrite rewrites the ?, $n and @name placeholders of qry to :n and :name
+// Oracle binds, leaving the string literals (including q'[...]' ones),
+// quoted identifiers and comments untouched.
+//
+// Native Oracle binds are left as is, and reported in Names, too.
+// Mixing the placeholder styles is an error.
+func Rewrite(qry string) (Query, error) {
+	var (
+		q    Query
+		buf  strings.Builder
+		seen = make(map[string]bool)
+		last int // start of the not yet copied part of qry
+		nQ   int // number of ? placeholders so far
+	)
+	add := func(style Style, name string, start, end int) error {
+		if q.Style != NoPlaceholders && q.Style != style {
+			return fmt.Errorf("mixed placeholder styles %s and %s at offset %d", q.Style, style, start)
+		}
+		q.Style = style
+		if !seen[name] {
+			seen[name] = true
+			q.Names = append(q.Names, name)
+		}
+		if style != Oracle {
+			buf.WriteString(qry[last:start])
+			buf.WriteByte(':')
+			buf.WriteString(name)
+			last = end
+		}
+		return nil
+	}
+
+	for i := 0; i < len(qry); {
+		c := qry[i]
+		switch {
+		case c == '\'':
+			end, err := skipString(qry, i)
+			if err != nil {
+				return q, err
+			}
+			i = end
+		case c == '"':
+			end := strings.IndexByte(qry[i+1:], '"')
+			if end < 0 {
+				return q, fmt.Errorf("unterminated quoted identifier at offset %d", i)
+			}
+			i = skipDBLink(qry, i+end+2)
+		case c == '-' && strings.HasPrefix(qry[i:], "--"):
+			end := strings.IndexByte(qry[i:], '\n')
+			if end < 0 {
+				i = len(qry)
+			} else {
+				i += end + 1
+			}
+		case c == '/' && strings.HasPrefix(qry[i:], "/*"):
+			end := strings.Index(qry[i+2:], "*/")
+			if end < 0 {
+				return q, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			i += end + 4
+		case (c == 'q' || c == 'Q') && isQuoteStart(qry, i):
+			end, err := skipQString(qry, i)
+			if err != nil {
+				return q, err
+			}
+			i = end
+		case (c == 'n' || c == 'N') && i+1 < len(qry) && (qry[i+1] == 'q' || qry[i+1] == 'Q') && isQuoteStart(qry, i+1):
+			end, err := skipQString(qry, i+1)
+			if err != nil {
+				return q, err
+			}
+			i = end
+		case c == '$' && i+1 < len(qry) && isDigit(qry[i+1]):
+			end := i + 1
+			for end < len(qry) && isDigit(qry[end]) {
+				end++
+			}
+			if err := add(Dollar, qry[i+1:end], i, end); err != nil {
+				return q, err
+			}
+			i = end
+		case isIdentChar(c):
+			// skip the whole word, so that $ inside identifiers is left alone
+			for i < len(qry) && isIdentChar(qry[i]) {
+				i++
+			}
+			i = skipDBLink(qry, i)
+		case c == '?':
+			nQ++
+			if err := add(Question, strconv.Itoa(nQ), i, i+1); err != nil {
+				return q, err
+			}
+			i++
+		case c == '@' && i+1 < len(qry) && isIdentStart(qry[i+1]):
+			end := i + 1
+			for end < len(qry) && isIdentChar(qry[end]) {
+				end++
+			}
+			if err := add(At, qry[i+1:end], i, end); err != nil {
+				return q, err
+			}
+			i = end
+		case c == ':' && i+1 < len(qry) && isIdentChar(qry[i+1]) && qry[i+1] != '$' && qry[i+1] != '#':
+			end := i + 1
+			for end < len(qry) && isIdentChar(qry[end]) {
+				end++
+			}
+			if err := add(Oracle, qry[i+1:end], i, end); err != nil {
+				return q, err
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	if last == 0 {
+		q.SQL = qry
+	} else {
+		buf.WriteString(qry[last:])
+		q.SQL = buf.String()
+	}
+	return q, nil
+}
+
+// skipDBLink skips the @dblink following an identifier ending at i.
+func skipDBLink(qry string, i int) int {
+	if i >= len(qry) || qry[i] != '@' {
+		return i
+	}
+	for i++; i < len(qry) && (isIdentChar(qry[i]) || qry[i] == '.'); i++ {
+	}
+	return i
+}
+
+// skipString returns the end of the '...' literal starting at i.
+func skipString(qry string, i int) (int, error) {
+	for j := i + 1; j < len(qry); j++ {
+		if qry[j] != '\'' {
+			continue
+		}
+		if j+1 < len(qry) && qry[j+1] == '\'' { // escaped quote
+			j++
+			continue
+		}
+		return j + 1, nil
+	}
+	return 0, fmt.Errorf("unterminated string literal at offset %d", i)
+}
+
+// isQuoteStart reports whether a q'X...X' literal starts at i.
+func isQuoteStart(qry string, i int) bool {
+	return i+2 < len(qry) && qry[i+1] == '\'' && (i == 0 || !isIdentChar(qry[i-1]))
+}
+
+// skipQString returns the end of the q'X...X' literal starting at i.
+func skipQString(qry string, i int) (int, error) {
+	open := qry[i+2]
+	close := open
+	switch open {
+	case '[':
+		close = ']'
+	case '{':
+		close = '}'
+	case '<':
+		close = '>'
+	case '(':
+		close = ')'
+	}
+	end := strings.Index(qry[i+3:], string([]byte{close, '\''}))
+	if end < 0 {
+		return 0, fmt.Errorf("unterminated q'%c literal at offset %d", open, i)
+	}
+	return i + 3 + end + 2, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+// isIdentChar reports whether c can be part of an unquoted identifier.
+// Bytes of multi-byte UTF-8 characters are accepted, too.
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$' || c == '#'
+}
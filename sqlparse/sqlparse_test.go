@@ -0,0 +1,121 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	for i, tc := range []struct {
+		in, out string
+		names   []string
+		style   Style
+	}{
+		{"SELECT 1 FROM DUAL", "SELECT 1 FROM DUAL", nil, NoPlaceholders},
+		{"SELECT ? FROM DUAL WHERE ? = 1", "SELECT :1 FROM DUAL WHERE :2 = 1", []string{"1", "2"}, Question},
+		{"SELECT ?,?", "SELECT :1,:2", []string{"1", "2"}, Question},
+		{"SELECT $1, $2, $1 FROM DUAL", "SELECT :1, :2, :1 FROM DUAL", []string{"1", "2"}, Dollar},
+		{"SELECT @a, @b_2 FROM DUAL WHERE x=@a", "SELECT :a, :b_2 FROM DUAL WHERE x=:a", []string{"a", "b_2"}, At},
+		{"SELECT :a, :1 FROM DUAL", "SELECT :a, :1 FROM DUAL", []string{"a", "1"}, Oracle},
+		{"BEGIN :x := 1; END;", "BEGIN :x := 1; END;", []string{"x"}, Oracle},
+		{"DECLARE v NUMBER; BEGIN v := ?; END;", "DECLARE v NUMBER; BEGIN v := :1; END;", []string{"1"}, Question},
+
+		// literals
+		{"SELECT '?', ? FROM DUAL", "SELECT '?', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT 'it''s ?', ? FROM DUAL", "SELECT 'it''s ?', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT '', ? FROM DUAL", "SELECT '', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT TO_DATE('2006-01-02 15:04', 'YYYY-MM-DD HH24:MI'), ? FROM DUAL",
+			"SELECT TO_DATE('2006-01-02 15:04', 'YYYY-MM-DD HH24:MI'), :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT q'[it's ?]', ? FROM DUAL", "SELECT q'[it's ?]', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT Q'{a}'']}', ? FROM DUAL", "SELECT Q'{a}'']}', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT q'<?>', q'(?)', q'!?'!', ? FROM DUAL", "SELECT q'<?>', q'(?)', q'!?'!', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT nq'[?]', N'?', ? FROM DUAL", "SELECT nq'[?]', N'?', :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT seq'?' FROM DUAL", "SELECT seq'?' FROM DUAL", nil, NoPlaceholders},
+
+		// quoted identifiers
+		{`SELECT "a?b", ? FROM DUAL`, `SELECT "a?b", :1 FROM DUAL`, []string{"1"}, Question},
+		{`SELECT "x:y" FROM DUAL WHERE 1 = :1`, `SELECT "x:y" FROM DUAL WHERE 1 = :1`, []string{"1"}, Oracle},
+
+		// comments
+		{"SELECT ? -- what?\nFROM DUAL", "SELECT :1 -- what?\nFROM DUAL", []string{"1"}, Question},
+		{"SELECT /* :a ? $1 @b */ ? FROM DUAL", "SELECT /* :a ? $1 @b */ :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT 1 FROM DUAL -- ?", "SELECT 1 FROM DUAL -- ?", nil, NoPlaceholders},
+		{"SELECT 10/2, ? FROM DUAL", "SELECT 10/2, :1 FROM DUAL", []string{"1"}, Question},
+		{"SELECT 10-2, ? FROM DUAL", "SELECT 10-2, :1 FROM DUAL", []string{"1"}, Question},
+
+		// $ and @ inside identifiers
+		{"SELECT sid FROM v$session WHERE sid = $1", "SELECT sid FROM v$session WHERE sid = :1", []string{"1"}, Dollar},
+		{"SELECT * FROM emp@remote WHERE id = @id", "SELECT * FROM emp@remote WHERE id = :id", []string{"id"}, At},
+		{`SELECT * FROM "EMP"@remote.world WHERE id = @id`, `SELECT * FROM "EMP"@remote.world WHERE id = :id`, []string{"id"}, At},
+		{"SELECT a#1 FROM t", "SELECT a#1 FROM t", nil, NoPlaceholders},
+
+		// multi-byte characters
+		{"SELECT 'árvíztűrő ?', ? AS tükör FROM DUAL", "SELECT 'árvíztűrő ?', :1 AS tükör FROM DUAL", []string{"1"}, Question},
+	} {
+		q, err := Rewrite(tc.in)
+		if err != nil {
+			t.Errorf("%d. %q: %v", i, tc.in, err)
+			continue
+		}
+		if q.SQL != tc.out {
+			t.Errorf("%d. %q: got %q, wanted %q", i, tc.in, q.SQL, tc.out)
+		}
+		if !reflect.DeepEqual(q.Names, tc.names) {
+			t.Errorf("%d. %q: got names %q, wanted %q", i, tc.in, q.Names, tc.names)
+		}
+		if q.Style != tc.style {
+			t.Errorf("%d. %q: got style %s, wanted %s", i, tc.in, q.Style, tc.style)
+		}
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	for i, tc := range []struct {
+		in, err string
+	}{
+		{"SELECT 'abc FROM DUAL", "unterminated string"},
+		{"SELECT 'it''s FROM DUAL", "unterminated string"},
+		{`SELECT "abc FROM DUAL`, "unterminated quoted identifier"},
+		{"SELECT /* ? FROM DUAL", "unterminated comment"},
+		{"SELECT q'[abc' FROM DUAL", "unterminated q'["},
+		{"SELECT ?, :1 FROM DUAL", "mixed placeholder styles"},
+		{"SELECT $1, ? FROM DUAL", "mixed placeholder styles"},
+		{"SELECT @a, $1 FROM DUAL", "mixed placeholder styles"},
+	} {
+		_, err := Rewrite(tc.in)
+		if err == nil {
+			t.Errorf("%d. %q: wanted error", i, tc.in)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%d. %q: got %v, wanted %q", i, tc.in, err, tc.err)
+		}
+	}
+}
+
+func TestStyleString(t *testing.T) {
+	for s, want := range map[Style]string{
+		NoPlaceholders: "none", Oracle: ":name", Question: "?", Dollar: "$n", At: "@name", Style(99): "Style(99)",
+	} {
+		if got := s.String(); got != want {
+			t.Errorf("%d: got %q, wanted %q", s, got, want)
+		}
+	}
+}
@@ -16,14 +16,20 @@ limitations under the License.
 
 package gocilib
 
-// #cgo LDFLAGS: -locilib
 // #include "ocilib.h"
 //
 import "C"
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const defaultPrefetchMemory = 1 << 20 // 1Mb
@@ -37,18 +43,42 @@ var ErrEmptyStatement = errors.New("empty statement")
 
 // Statement holds the OCI_Statement handle.
 //
-// PrefetchMemory and FetchSize are set in Statement.Prepare
+// PrefetchMemory and FetchSize are set in Statement.Prepare,
+// BatchSize is the number of rows sent at once by ExecuteMany,
+// NumberMode says how the NUMBER columns are returned by FetchInto.
 type Statement struct {
 	handle                    *C.OCI_Statement
+	conn                      *Connection
 	statement, verb           string
 	bindCount                 int
 	PrefetchMemory, FetchSize uint
+	BatchSize                 uint
+	NumberMode                NumberMode
+
+	// keep holds the Go memory used by the binds till the next Prepare.
+	keep []interface{}
+	// outs copy back the Out binds' values after the execution.
+	outs []func() error
+	// fieldMaps caches the column-field mappings of ScanStruct.
+	fieldMaps map[reflect.Type][][]int
+	// objects and colls are created for the struct and slice binds,
+	// frees free the other C values of the binds; see freeBinds.
+	objects []*Object
+	colls   []*Coll
+	frees   []func()
+	// implicit holds the wrappers of the implicit results; see NextResultset.
+	implicit []*C.OCI_Statement
+	// rebindKeys are the rebindKey of the values bound by the last bindExecute.
+	rebindKeys map[string]string
 }
 
 // NewStatement creates a new statement
 func (conn *Connection) NewStatement() (*Statement, error) {
-	stmt := Statement{handle: C.OCI_StatementCreate(conn.handle),
-		PrefetchMemory: defaultPrefetchMemory, FetchSize: defaultFetchSize}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	stmt := Statement{handle: C.OCI_StatementCreate(conn.handle), conn: conn,
+		PrefetchMemory: defaultPrefetchMemory, FetchSize: defaultFetchSize,
+		BatchSize: uint(BindArraySize)}
 	if stmt.handle == nil {
 		return nil, getLastErr()
 	}
@@ -66,12 +96,17 @@ func (conn *Connection) NewPreparedStatement(qry string) (*Statement, error) {
 
 // Close closes the statement.
 func (stmt *Statement) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if stmt.handle != nil {
+		stmt.freeImplicit()
 		if C.OCI_StatementFree(stmt.handle) != C.TRUE {
 			return getLastErr()
 		}
 		stmt.handle = nil
 		stmt.statement, stmt.verb, stmt.bindCount = "", "", 0
+		stmt.fieldMaps = nil
+		stmt.resetBinds()
 	}
 	return nil
 }
@@ -80,26 +115,51 @@ func (stmt *Statement) Close() error {
 // After Prepare, you can Execute/BindExecute the statement already prepared,
 // by executing with empty qry.
 func (stmt *Statement) Prepare(qry string) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	start := time.Now()
+	stmt.freeImplicit()
 	if C.OCI_Prepare(stmt.handle, C.CString(qry)) != C.TRUE {
-		return getLastErr()
+		err := getLastErr()
+		stmt.trace(TraceEvent{Kind: TracePrepare, SQL: qry, Duration: time.Since(start), Err: err})
+		return err
 	}
+	stmt.trace(TraceEvent{Kind: TracePrepare, SQL: qry, Duration: time.Since(start)})
 	stmt.statement, stmt.verb = qry, ""
 	stmt.bindCount = int(C.OCI_GetBindCount(stmt.handle))
+	stmt.fieldMaps = nil
+	stmt.rebindKeys = nil
+	stmt.resetBinds()
 	return stmt.setFetchSizes()
 }
 
 // Execute the given query.
 // If qry is "", then the previously prepared/executed query string is used.
 func (stmt *Statement) Execute(qry string) error {
+	start := time.Now()
+	err := stmt.execute(qry)
+	stmt.traceExecute(qry, start, err)
+	return err
+}
+
+func (stmt *Statement) execute(qry string) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer stmt.drainServerOutput()
 	if qry == "" {
 		qry = stmt.statement
 	}
 	if qry == "" {
 		return ErrEmptyStatement
 	}
+	stmt.freeImplicit()
+	stmt.rebindKeys = nil
 	if C.OCI_ExecuteStmt(stmt.handle, C.CString(qry)) != C.TRUE {
 		return getLastErr()
 	}
+	if qry != stmt.statement {
+		stmt.fieldMaps = nil
+	}
 	stmt.statement = qry
 	if err := stmt.setFetchSizes(); err != nil {
 		return err
@@ -109,49 +169,236 @@ func (stmt *Statement) Execute(qry string) error {
 	return nil
 }
 
-// BindExecute binds the given variables (array or map) and then executes the statement.
+// BindExecute binds the given variables (array and/or map) and then executes the statement.
+// The array elements are bound by position (:1, :2, ...), the map elements by name.
 func (stmt *Statement) BindExecute(
 	qry string,
 	arrayArgs []driver.Value,
 	mapArgs map[string]driver.Value,
 ) error {
+	start := time.Now()
+	err := stmt.bindExecute(qry, arrayArgs, mapArgs)
+	stmt.traceExecute(qry, start, err)
+	return err
+}
+
+func (stmt *Statement) bindExecute(
+	qry string,
+	arrayArgs []driver.Value,
+	mapArgs map[string]driver.Value,
+) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer stmt.drainServerOutput()
 	if qry == "" {
 		qry = stmt.statement
 	}
 	if qry == "" {
 		return ErrEmptyStatement
 	}
-	if qry != stmt.statement {
+	stmt.freeImplicit()
+	// OCILIB rebinds a name only to a value of the same type (see rebindKey),
+	// so a statement bound otherwise is prepared again, dropping the binds
+	// of the previous execution (the binds made without OCILIB,
+	// such as of Number, have frees).
+	keys := rebindKeys(arrayArgs, mapArgs)
+	bound := C.OCI_GetBindCount(stmt.handle) > 0
+	if qry != stmt.statement || len(stmt.frees) > 0 || bound && !sameRebindKeys(stmt.rebindKeys, keys) {
 		if C.OCI_Prepare(stmt.handle, C.CString(qry)) != C.TRUE {
 			return getLastErr()
 		}
 		if err := stmt.setFetchSizes(); err != nil {
 			return err
 		}
+		if qry != stmt.statement {
+			stmt.fieldMaps = nil
+		}
+		stmt.statement = qry
+	} else if bound && C.OCI_AllowRebinding(stmt.handle, C.TRUE) != C.TRUE {
+		return getLastErr()
 	}
+	stmt.rebindKeys = nil
+	stmt.resetBinds()
 	//if C.OCI_BindArraySetSize(stmt.handle, BindArraySize) != C.TRUE {
 	//	return getLastErr()
 	//}
-	if len(arrayArgs) > 0 {
-		for i, a := range arrayArgs {
-			if err := stmt.BindPos(i+1, a); err != nil {
-				return err
-			}
+	for i, a := range arrayArgs {
+		if err := stmt.BindPos(i+1, a); err != nil {
+			return err
 		}
-	} else if len(mapArgs) > 0 {
-		for k, a := range mapArgs {
-			if err := stmt.BindName(k, a); err != nil {
-				return err
-			}
+	}
+	for k, a := range mapArgs {
+		if err := stmt.BindName(k, a); err != nil {
+			return err
 		}
 	}
+	stmt.rebindKeys = keys
 	if C.OCI_Execute(stmt.handle) != C.TRUE {
 		return getLastErr()
 	}
+	return stmt.copyOuts()
+}
+
+// rebindKey returns the type of value if OCILIB can rebind a name bound
+// to such a value to another value of the same type, "" otherwise:
+// the values of the other types are bound without OCILIB, with a NULL
+// indicator, or with some state (Out binds, objects, collections...).
+func rebindKey(value driver.Value) string {
+	switch value.(type) {
+	case int16, *int16, uint16, *uint16, int, uint, *uint, int64, *int64, uint64, *uint64,
+		string, StringVar, *StringVar, []byte, float32, *float32, float64, *float64:
+		return fmt.Sprintf("%T", value)
+	}
+	return ""
+}
+
+// rebindKeys returns the rebindKey of each bound value, by bind name.
+func rebindKeys(arrayArgs []driver.Value, mapArgs map[string]driver.Value) map[string]string {
+	keys := make(map[string]string, len(arrayArgs)+len(mapArgs))
+	for i, a := range arrayArgs {
+		keys[":"+strconv.Itoa(i+1)] = rebindKey(a)
+	}
+	for k, a := range mapArgs {
+		keys[k] = rebindKey(a)
+	}
+	return keys
+}
+
+// sameRebindKeys reports whether all the names bound with the prev keys can be
+// rebound to the values of the next keys.
+func sameRebindKeys(prev, next map[string]string) bool {
+	if len(prev) == 0 || len(prev) != len(next) {
+		return false
+	}
+	for k, v := range prev {
+		if v == "" || next[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// resetBinds releases the Go memory and the C values of the previous binds,
+// and forgets their copy-back functions.
+func (stmt *Statement) resetBinds() {
+	stmt.keep, stmt.outs = nil, nil
+	stmt.freeBinds()
+}
+
+// traceExecute traces the execution of qry, started at start.
+func (stmt *Statement) traceExecute(qry string, start time.Time, err error) {
+	ev := TraceEvent{Kind: TraceExecute, SQL: qry, Duration: time.Since(start), Err: err}
+	if ev.SQL == "" {
+		ev.SQL = stmt.statement
+	}
+	if stmt.handle != nil {
+		ev.BindCount = int(C.OCI_GetBindCount(stmt.handle))
+		if err == nil {
+			ev.Rows = int64(C.OCI_GetAffectedRows(stmt.handle))
+		}
+	}
+	stmt.trace(ev)
+}
+
+// drainServerOutput writes the DBMS_OUTPUT lines to the writer set with
+// Connection.ServerOutputTo. It is deferred, to run after the error
+// of the execution has been fetched.
+func (stmt *Statement) drainServerOutput() {
+	if stmt.conn != nil && stmt.conn.serverOutput != nil {
+		stmt.conn.drainServerOutput()
+	}
+}
+
+// ExecuteContext is like Execute, but breaks the execution with OCI_Break
+// when the ctx is done.
+func (stmt *Statement) ExecuteContext(ctx context.Context, qry string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := stmt.watchContext(ctx)
+	return stop(stmt.Execute(qry))
+}
+
+// BindExecuteContext is like BindExecute, but breaks the execution with OCI_Break
+// when the ctx is done.
+func (stmt *Statement) BindExecuteContext(
+	ctx context.Context,
+	qry string,
+	arrayArgs []driver.Value,
+	mapArgs map[string]driver.Value,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := stmt.watchContext(ctx)
+	return stop(stmt.BindExecute(qry, arrayArgs, mapArgs))
+}
+
+// watchContext starts watching the ctx, and calls OCI_Break on the statement's
+// connection when the ctx is done before the returned stop function is called.
+//
+// stop must be called with the result of the watched call, and returns
+// the ctx.Err() wrapped with that error (ORA-01013) if the call has been broken.
+func (stmt *Statement) watchContext(ctx context.Context) (stop func(error) error) {
+	return watchBreak(ctx, C.OCI_StatementGetConnection(stmt.handle))
+}
+
+// watchBreak calls OCI_Break on the connection when the ctx is done before
+// the returned stop function is called. See Statement.watchContext.
+func watchBreak(ctx context.Context, conn *C.OCI_Connection) (stop func(error) error) {
+	if ctx.Done() == nil {
+		return func(err error) error { return err }
+	}
+	var (
+		mu               sync.Mutex
+		finished, broken bool
+	)
+	stopCh := make(chan struct{})
+	go func() {
+		select {
+		case <-stopCh:
+			return
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		if !finished {
+			broken = true
+			C.OCI_Break(conn)
+		}
+		mu.Unlock()
+	}()
+	return func(err error) error {
+		close(stopCh)
+		mu.Lock()
+		finished = true
+		wasBroken := broken
+		mu.Unlock()
+		if wasBroken && err != nil {
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		return err
+	}
+}
+
+// SetScrollable makes the resultsets of the statement scrollable
+// (see Resultset.Prev, First, Last and Seek), or forward-only (the default).
+// It must be called before the execution.
+func (stmt *Statement) SetScrollable(scrollable bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	mode := C.uint(C.OCI_SFM_DEFAULT)
+	if scrollable {
+		mode = C.OCI_SFM_SCROLLABLE
+	}
+	if C.OCI_SetFetchMode(stmt.handle, mode) != C.TRUE {
+		return getLastErr()
+	}
 	return nil
 }
 
 func (stmt *Statement) setFetchSizes() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if stmt.verb != "SELECT" {
 		return nil
 	}
@@ -201,6 +448,8 @@ func (stmt *Statement) RowsAffected() int64 {
 // Parse will send the qry for parsing to the server.
 // Only good for testing parse errors.
 func (stmt *Statement) Parse(qry string) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if C.OCI_Parse(stmt.handle, C.CString(qry)) != C.TRUE {
 		return getLastErr()
 	}
@@ -210,12 +459,17 @@ func (stmt *Statement) Parse(qry string) error {
 // QueryRow mimics *sql.DB.QueryRow, in that it executes the query and then
 // fetches the first row into dest.
 func (stmt *Statement) QueryRow(qry string, args []driver.Value, dest []driver.Value) error {
+	return stmt.QueryRowContext(context.Background(), qry, args, dest)
+}
+
+// QueryRowContext is like QueryRow, but breaks the execution and the fetch
+// with OCI_Break when the ctx is done.
+func (stmt *Statement) QueryRowContext(ctx context.Context, qry string, args []driver.Value, dest []driver.Value) error {
 	var err error
-	Log.Debug("QueryRow", "qry", qry, "args", args)
 	if len(args) > 0 {
-		err = stmt.BindExecute(qry, args, nil)
+		err = stmt.BindExecuteContext(ctx, qry, args, nil)
 	} else {
-		err = stmt.Execute(qry)
+		err = stmt.ExecuteContext(ctx, qry)
 	}
 	if err != nil {
 		return err
@@ -225,11 +479,8 @@ func (stmt *Statement) QueryRow(qry string, args []driver.Value, dest []driver.V
 		return err
 	}
 	defer rs.Close()
-	if err = rs.Next(); err != nil {
+	if err = rs.NextContext(ctx); err != nil {
 		return err
 	}
-	Log.Debug("FI", "dest", dest)
-	err = rs.FetchInto(dest)
-	Log.Debug("FI", "dest", dest, "error", err)
-	return err
+	return rs.FetchInto(dest)
 }
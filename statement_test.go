@@ -0,0 +1,81 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreak(t *testing.T) {
+	cx, st := testStatement(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	// the aggregate is computed at the execution or at the first fetch
+	err := st.ExecuteContext(ctx, "SELECT COUNT(0) FROM all_objects a, all_objects b, all_objects c")
+	if err == nil {
+		var rs *Resultset
+		if rs, err = st.Results(); err == nil {
+			err = rs.NextContext(ctx)
+		}
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wanted DeadlineExceeded, got %v", err)
+	}
+	// the driver sees the ORA error of the break, too
+	if oraErr, ok := AsError(err); !ok || oraErr.Code != 1013 {
+		t.Errorf("wanted ORA-01013, got %v", err)
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("the break took %s", d)
+	}
+
+	// the connection is usable after the break
+	if row := queryRow(t, cx, "SELECT 1 FROM DUAL"); row[0] != int64(1) {
+		t.Errorf("got %#v after the break", row)
+	}
+}
+
+func TestRebindKeys(t *testing.T) {
+	i, s := int64(1), "a"
+	keys := rebindKeys([]driver.Value{i, s}, nil)
+	for j, tc := range []struct {
+		arrayArgs []driver.Value
+		mapArgs   map[string]driver.Value
+		want      bool
+	}{
+		{[]driver.Value{int64(2), "b"}, nil, true},
+		{[]driver.Value{&i, "b"}, nil, false},
+		{[]driver.Value{int64(2)}, nil, false},
+		{[]driver.Value{int64(2), Number("1.5")}, nil, false},
+		{nil, map[string]driver.Value{":1": int64(2), ":2": "b"}, true},
+	} {
+		if got := sameRebindKeys(keys, rebindKeys(tc.arrayArgs, tc.mapArgs)); got != tc.want {
+			t.Errorf("%d. got %t, wanted %t", j, got, tc.want)
+		}
+	}
+	// the Number is bound without OCILIB, so it cannot be rebound
+	keys = rebindKeys([]driver.Value{Number("1.5")}, nil)
+	if sameRebindKeys(keys, keys) {
+		t.Error("a Number bind can be rebound")
+	}
+}
@@ -17,7 +17,7 @@ limitations under the License.
 package gocilib
 
 /*
-#cgo LDFLAGS: -locilib -lclntsh
+#cgo LDFLAGS: -lclntsh
 #include "ocilib.h"
 #include "oci.h"
 
@@ -30,7 +30,7 @@ import "C"
 import (
 	"bytes"
 	"errors"
-	"log"
+	"runtime"
 	"strings"
 	"sync"
 	"unsafe"
@@ -64,6 +64,8 @@ var (
 )
 
 func (conn *Connection) NewLibSubscription(name string, evt EventType, rowidsNeeded bool, timeout int) (Subscription, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	subscriptionsMu.Lock()
 	defer subscriptionsMu.Unlock()
 	if libSubscriptions == nil {
@@ -93,6 +95,8 @@ func (conn *Connection) NewLibSubscription(name string, evt EventType, rowidsNee
 
 // AddStatement adds the statement to be watched, and returns the event channel.
 func (subs *libSubscription) AddStatement(st *Statement) (<-chan Event, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	if C.OCI_SubscriptionAddStatement(subs.handle, st.handle) != C.TRUE {
 		return nil, getLastErr()
 	}
@@ -112,6 +116,8 @@ func (subs *libSubscription) AddQuery(conn *Connection, qry string) (<-chan Even
 }
 
 func (subs *libSubscription) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 	var err error
 	if subs.handle != nil {
 		subscriptionsMu.Lock()
@@ -143,11 +149,11 @@ type Event struct {
 //export goNotificationCallback
 func goNotificationCallback(Cname *C.char, notifyType, op C.uint, Cdatabase, Cobject, Crowid *C.char) {
 	name := C.GoString(Cname)
-	log.Printf("CALLBACK NAME=%s type=%d", name, notifyType)
+	Log.Debug("notification", "name", name, "type", int(notifyType))
 
 	subs := getSubscriptionFromName(name)
 	if subs == nil || subs.name == "" {
-		log.Printf("Cannot find subscription name %q.", name)
+		Log.Warn("cannot find subscription", "name", name)
 		return
 	}
 	evt := Event{Type: int(notifyType), Op: int(op), Database: C.GoString(Cdatabase)}
@@ -172,7 +178,7 @@ func goNotificationCallback(Cname *C.char, notifyType, op C.uint, Cdatabase, Cob
 	select {
 	case subs.events <- evt:
 	default:
-		log.Printf("WARN: cannot send event %v.", evt)
+		Log.Warn("cannot send event", "name", name, "event", evt)
 	}
 }
 
@@ -197,5 +203,5 @@ func getLastRawError(con *C.OCI_Connection) *Error {
 		}
 		message = append(message, string(errbuf[:bytes.IndexByte(errbuf, 0)]))
 	}
-	return &Error{Code: errorcode, Text: strings.Join(message, "")}
+	return &Error{Code: errorcode, Text: strings.Join(message, ""), Type: ErrOracle}
 }
@@ -0,0 +1,26 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ocilib builds the vendored OCILIB 3.12.1 sources,
+// so gocilib links exactly the version whose internals it reaches,
+// not whatever libocilib is installed.
+//
+// It has no Go API; gocilib imports it for its C symbols only.
+package ocilib
+
+// #cgo CFLAGS: -I${SRCDIR}/../include -DOCI_IMPORT_LINKAGE -DOCI_CHARSET_ANSI -w
+// #cgo LDFLAGS: -lclntsh
+import "C"
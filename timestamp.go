@@ -0,0 +1,248 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// TimeType is the Oracle type a time.Time is bound as.
+type TimeType uint8
+
+const (
+	// TimeAuto is TIMESTAMP WITH TIME ZONE if the location of the time
+	// is not time.Local, and TIMESTAMP otherwise.
+	TimeAuto = TimeType(iota)
+	// TimeDate is DATE: without fractional seconds and time zone.
+	TimeDate
+	// TimeTimestamp is TIMESTAMP, without time zone.
+	TimeTimestamp
+	// TimeTimestampTZ is TIMESTAMP WITH TIME ZONE.
+	TimeTimestampTZ
+	// TimeTimestampLTZ is TIMESTAMP WITH LOCAL TIME ZONE.
+	TimeTimestampLTZ
+)
+
+func (tt TimeType) String() string {
+	switch tt {
+	case TimeAuto:
+		return "auto"
+	case TimeDate:
+		return "DATE"
+	case TimeTimestamp:
+		return "TIMESTAMP"
+	case TimeTimestampTZ:
+		return "TIMESTAMP WITH TIME ZONE"
+	case TimeTimestampLTZ:
+		return "TIMESTAMP WITH LOCAL TIME ZONE"
+	}
+	return fmt.Sprintf("TimeType(%d)", tt)
+}
+
+// TimeAs binds Time as Type, instead of the TimeAuto type of a plain time.Time.
+//
+// For example, compare DATE columns to TimeDate binds, as comparing them to
+// a TIMESTAMP converts the column, and prevents using its indexes.
+type TimeAs struct {
+	Time time.Time
+	Type TimeType
+}
+
+// ociType returns the OCI_TIMESTAMP_* type of tt for t, 0 for DATE.
+func (tt TimeType) ociType(t time.Time) C.uint {
+	switch tt {
+	case TimeDate:
+		return 0
+	case TimeTimestamp:
+		return C.OCI_TIMESTAMP
+	case TimeTimestampTZ:
+		return C.OCI_TIMESTAMP_TZ
+	case TimeTimestampLTZ:
+		return C.OCI_TIMESTAMP_LTZ
+	}
+	if t.Location() != time.Local {
+		return C.OCI_TIMESTAMP_TZ
+	}
+	return C.OCI_TIMESTAMP
+}
+
+// bindTime binds the time as ta.Type.
+func (stmt *Statement) bindTime(name string, ta TimeAs) error {
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	con := C.OCI_StatementGetConnection(h)
+	var ok C.int
+	if typ := ta.Type.ociType(ta.Time); typ == 0 {
+		od, err := newOCIDate(con, ta.Time)
+		if err != nil {
+			return fmt.Errorf("BindName(%s): %v", name, err)
+		}
+		stmt.frees = append(stmt.frees, func() { C.OCI_DateFree(od) })
+		ok = C.OCI_BindDate(h, nm, od)
+	} else {
+		ts, err := newOCITimestamp(con, typ, ta.Time)
+		if err != nil {
+			return fmt.Errorf("BindName(%s): %v", name, err)
+		}
+		stmt.frees = append(stmt.frees, func() { C.OCI_TimestampFree(ts) })
+		ok = C.OCI_BindTimestamp(h, nm, ts)
+	}
+	if ok != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	return nil
+}
+
+// bindTimes binds the times as an array of timestamps: with time zone,
+// if any of them is not in time.Local.
+func (stmt *Statement) bindTimes(name string, times []time.Time) error {
+	if len(times) == 0 {
+		return fmt.Errorf("BindName(%s): empty []time.Time", name)
+	}
+	typ := C.uint(C.OCI_TIMESTAMP)
+	for _, t := range times {
+		if t.Location() != time.Local {
+			typ = C.OCI_TIMESTAMP_TZ
+			break
+		}
+	}
+	h, nm := stmt.handle, C.CString(name)
+	defer C.free(unsafe.Pointer(nm))
+	arr := C.OCI_TimestampArrayCreate(C.OCI_StatementGetConnection(h), typ, C.uint(len(times)))
+	if arr == nil {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	stmt.frees = append(stmt.frees, func() { C.OCI_TimestampArrayFree(arr) })
+	for i, ts := range unsafe.Slice(arr, len(times)) {
+		if err := setOCITimestamp(ts, typ, times[i]); err != nil {
+			return fmt.Errorf("BindName(%s): %d. %v", name, i, err)
+		}
+	}
+	if C.OCI_BindArrayOfTimestamps(h, nm, arr, typ, C.uint(len(times))) != C.TRUE {
+		return fmt.Errorf("BindName(%s): %v", name, getLastErr())
+	}
+	return nil
+}
+
+// newOCITimestamp returns a new OCI_Timestamp of the given type, set to t.
+// It must be freed with OCI_TimestampFree.
+func newOCITimestamp(con *C.OCI_Connection, typ C.uint, t time.Time) (*C.OCI_Timestamp, error) {
+	ts := C.OCI_TimestampCreate(con, typ)
+	if ts == nil {
+		return nil, getLastErr()
+	}
+	if err := setOCITimestamp(ts, typ, t); err != nil {
+		C.OCI_TimestampFree(ts)
+		return nil, err
+	}
+	return ts, nil
+}
+
+// setOCITimestamp sets the OCI_Timestamp of the given type to t, to the nanosecond.
+// The time zone is t's region name (such as Europe/Budapest), or its offset if
+// Oracle does not know the region.
+func setOCITimestamp(ts *C.OCI_Timestamp, typ C.uint, t time.Time) error {
+	y, m, d := t.Date()
+	H, M, S := t.Clock()
+	construct := func(tz string) C.int {
+		if typ == C.OCI_TIMESTAMP {
+			return C.OCI_TimestampConstruct(ts, C.int(y), C.int(m), C.int(d), C.int(H), C.int(M), C.int(S),
+				C.int(t.Nanosecond()), nil)
+		}
+		ctz := C.CString(tz)
+		defer C.free(unsafe.Pointer(ctz))
+		return C.OCI_TimestampConstruct(ts, C.int(y), C.int(m), C.int(d), C.int(H), C.int(M), C.int(S),
+			C.int(t.Nanosecond()), (*C.mtext)(unsafe.Pointer(ctz)))
+	}
+	_, offset := t.Zone()
+	if region := regionName(t.Location()); region != "" && construct(region) == C.TRUE {
+		return nil
+	}
+	if construct(zoneOffset(offset)) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// regionName returns the IANA name of the location, "" for the locations
+// without one (Local, and the FixedZones).
+func regionName(loc *time.Location) string {
+	if name := loc.String(); name == "UTC" || strings.Contains(name, "/") {
+		return name
+	}
+	return ""
+}
+
+// zoneOffset returns the offset (in seconds east of UTC) as [+-]HH:MM.
+func zoneOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// ociTimestampToTime returns the timestamp as time.Time, to the nanosecond.
+//
+// TIMESTAMP values are in time.Local; the zoned ones in their region
+// (if known to Go), or in a FixedZone of their offset.
+func ociTimestampToTime(ts *C.OCI_Timestamp) (time.Time, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var y, m, d, H, M, S, F C.int
+	if C.OCI_TimestampGetDateTime(ts, &y, &m, &d, &H, &M, &S, &F) != C.TRUE {
+		return time.Time{}, getLastErr()
+	}
+	zone := time.Local
+	if C.OCI_TimestampGetType(ts) != C.OCI_TIMESTAMP {
+		var err error
+		if zone, err = ociTimestampZone(ts); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(int(y), time.Month(m), int(d), int(H), int(M), int(S), int(F), zone), nil
+}
+
+// ociTimestampZone returns the time zone of the zoned timestamp.
+func ociTimestampZone(ts *C.OCI_Timestamp) (*time.Location, error) {
+	var oh, om C.int
+	if C.OCI_TimestampGetTimeZoneOffset(ts, &oh, &om) != C.TRUE {
+		return nil, getLastErr()
+	}
+	offset := int(oh*60+om) * 60
+	b := make([]byte, 64)
+	if C.OCI_TimestampGetTimeZoneName(ts, C.int(len(b)), (*C.mtext)(unsafe.Pointer(&b[0]))) == C.TRUE {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		name := string(b)
+		if name != "" && name[0] != '+' && name[0] != '-' {
+			if loc, err := time.LoadLocation(name); err == nil {
+				return loc, nil
+			}
+		}
+	}
+	return time.FixedZone(zoneOffset(offset), offset), nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZoneOffset(t *testing.T) {
+	for _, tc := range []struct {
+		offset int
+		want   string
+	}{
+		{0, "+00:00"},
+		{3600, "+01:00"},
+		{5*3600 + 30*60, "+05:30"},
+		{-(9*3600 + 30*60), "-09:30"},
+		{-14 * 3600, "-14:00"},
+		{14 * 3600, "+14:00"},
+	} {
+		if got := zoneOffset(tc.offset); got != tc.want {
+			t.Errorf("zoneOffset(%d): got %q, wanted %q.", tc.offset, got, tc.want)
+		}
+	}
+}
+
+func TestRegionName(t *testing.T) {
+	for _, tc := range []struct {
+		loc  *time.Location
+		want string
+	}{
+		{time.UTC, "UTC"},
+		{time.Local, ""},
+		{time.FixedZone("CET", 3600), ""},
+		{time.FixedZone("", -3600), ""},
+	} {
+		if got := regionName(tc.loc); got != tc.want {
+			t.Errorf("regionName(%v): got %q, wanted %q.", tc.loc, got, tc.want)
+		}
+	}
+	if loc, err := time.LoadLocation("Europe/Budapest"); err != nil {
+		t.Log(err)
+	} else if got := regionName(loc); got != "Europe/Budapest" {
+		t.Errorf("regionName(%v): got %q, wanted Europe/Budapest.", loc, got)
+	}
+}
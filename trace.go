@@ -0,0 +1,180 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Log is the logger of gocilib - set it to a real logger to see the logs,
+// as by default it discards everything.
+//
+// The DefaultTracer logs the calls here, at Debug level.
+var Log = slog.New(slog.DiscardHandler)
+
+// TraceKind is the kind of a traced call.
+type TraceKind uint8
+
+const (
+	// TraceConnect is a new connection, or a connection got from a Pool.
+	TraceConnect = TraceKind(iota + 1)
+	// TracePrepare is a Statement.Prepare.
+	TracePrepare
+	// TraceBind is a bind of a value.
+	TraceBind
+	// TraceExecute is a Statement.Execute or BindExecute.
+	TraceExecute
+	// TraceFetch is the end of the fetch of a Resultset:
+	// its last Next, or its Close if it has not been fetched to the end.
+	TraceFetch
+	// TraceCommit is a Connection.Commit.
+	TraceCommit
+	// TraceRollback is a Connection.Rollback.
+	TraceRollback
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceConnect:
+		return "connect"
+	case TracePrepare:
+		return "prepare"
+	case TraceBind:
+		return "bind"
+	case TraceExecute:
+		return "execute"
+	case TraceFetch:
+		return "fetch"
+	case TraceCommit:
+		return "commit"
+	case TraceRollback:
+		return "rollback"
+	}
+	return "TraceKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// TraceEvent describes a traced call.
+type TraceEvent struct {
+	Kind TraceKind
+	// Duration is the length of the call; for TraceFetch, the time since
+	// the resultset has been got.
+	Duration time.Duration
+	// Target is the user@sid of TraceConnect.
+	Target string
+	// SQL is the statement of TracePrepare, TraceExecute and TraceFetch.
+	SQL string
+	// BindName and BindValue are the bind of TraceBind.
+	// BindValue is the raw value: redact it before logging!
+	BindName  string
+	BindValue interface{}
+	// BindCount is the number of binds of TraceExecute.
+	BindCount int
+	// Rows is the number of rows affected by TraceExecute,
+	// and the number of rows fetched by TraceFetch.
+	Rows int64
+	// Err is the error of the call.
+	Err error
+}
+
+// Tracer receives the TraceEvents of a Connection and its statements.
+// Trace is called synchronously, after each call.
+type Tracer interface {
+	Trace(TraceEvent)
+}
+
+// DefaultTracer traces the connections without a Tracer of their own.
+// Set it to nil to disable tracing.
+var DefaultTracer Tracer = SlogTracer{Level: slog.LevelDebug}
+
+// SlogTracer is a Tracer which logs the events to a slog.Logger.
+type SlogTracer struct {
+	// Logger is the logger, Log if nil.
+	Logger *slog.Logger
+	// Level is the level of the successful calls, the failed ones
+	// are logged at Error level.
+	Level slog.Level
+	// Redact returns the loggable form of a bind value.
+	// If nil, only the type of the bind values is logged.
+	Redact func(name string, value interface{}) interface{}
+}
+
+// Trace logs the event.
+func (t SlogTracer) Trace(ev TraceEvent) {
+	logger, level := t.Logger, t.Level
+	if logger == nil {
+		logger = Log
+	}
+	if ev.Err != nil {
+		level = slog.LevelError
+	}
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, 6)
+	switch ev.Kind {
+	case TraceConnect:
+		attrs = append(attrs, slog.String("target", ev.Target))
+	case TracePrepare:
+		attrs = append(attrs, slog.String("sql", ev.SQL))
+	case TraceBind:
+		attrs = append(attrs, slog.String("name", ev.BindName))
+		if t.Redact == nil {
+			attrs = append(attrs, slog.String("type", fmt.Sprintf("%T", ev.BindValue)))
+		} else {
+			attrs = append(attrs, slog.Any("value", t.Redact(ev.BindName, ev.BindValue)))
+		}
+	case TraceExecute:
+		attrs = append(attrs, slog.String("sql", ev.SQL),
+			slog.Int("binds", ev.BindCount), slog.Int64("rows", ev.Rows))
+	case TraceFetch:
+		attrs = append(attrs, slog.String("sql", ev.SQL), slog.Int64("rows", ev.Rows))
+	}
+	if ev.Kind != TraceBind {
+		attrs = append(attrs, slog.Duration("duration", ev.Duration))
+	}
+	if ev.Err != nil {
+		attrs = append(attrs, slog.Any("error", ev.Err))
+	}
+	logger.LogAttrs(ctx, level, ev.Kind.String(), attrs...)
+}
+
+// SetTracer sets the Tracer of the connection and its statements.
+// nil means DefaultTracer.
+func (conn *Connection) SetTracer(t Tracer) {
+	conn.tracer = t
+}
+
+// trace sends the event to the tracer of the connection.
+func (conn *Connection) trace(ev TraceEvent) {
+	t := DefaultTracer
+	if conn != nil && conn.tracer != nil {
+		t = conn.tracer
+	}
+	if t != nil {
+		t.Trace(ev)
+	}
+}
+
+// trace sends the event to the tracer of the statement's connection.
+func (stmt *Statement) trace(ev TraceEvent) {
+	stmt.conn.trace(ev)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+// #include "ocilib.h"
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// IsolationLevel is the isolation level of a transaction.
+type IsolationLevel uint
+
+const (
+	// DefaultIsolation leaves the isolation level as is (READ COMMITTED by default).
+	DefaultIsolation = IsolationLevel(iota)
+	// ReadCommitted sees the data committed before each statement.
+	ReadCommitted
+	// Serializable sees only the data committed before the transaction.
+	Serializable
+)
+
+// TxOptions holds the options of BeginTx.
+type TxOptions struct {
+	Isolation IsolationLevel
+	// ReadOnly starts a read-only transaction, which sees only the data
+	// committed before the transaction, regardless of Isolation.
+	ReadOnly bool
+}
+
+// BeginTx starts a new local transaction with the given options,
+// with SET TRANSACTION. The transaction is ended with Commit or Rollback.
+func (conn *Connection) BeginTx(opts TxOptions) error {
+	var qry string
+	switch {
+	case opts.ReadOnly:
+		qry = "SET TRANSACTION READ ONLY"
+	case opts.Isolation == ReadCommitted:
+		qry = "SET TRANSACTION ISOLATION LEVEL READ COMMITTED"
+	case opts.Isolation == Serializable:
+		qry = "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"
+	case opts.Isolation == DefaultIsolation:
+		return nil
+	default:
+		return fmt.Errorf("BeginTx: unknown isolation level %d", opts.Isolation)
+	}
+	stmt, err := conn.NewStatement()
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	return stmt.Execute(qry)
+}
+
+// TxMode is the mode of a Transaction.
+type TxMode uint
+
+const (
+	// TxNew starts a new, tightly coupled and migratable global branch.
+	TxNew = TxMode(C.OCI_TRS_NEW)
+	// TxTight starts a tightly coupled global branch.
+	TxTight = TxMode(C.OCI_TRS_TIGHT)
+	// TxLoose starts a loosely coupled global branch.
+	TxLoose = TxMode(C.OCI_TRS_LOOSE)
+	// TxReadOnly starts a read-only transaction.
+	TxReadOnly = TxMode(C.OCI_TRS_READONLY)
+	// TxReadWrite starts a read-write transaction.
+	TxReadWrite = TxMode(C.OCI_TRS_READWRITE)
+	// TxSerializable starts a serializable transaction.
+	TxSerializable = TxMode(C.OCI_TRS_SERIALIZABLE)
+)
+
+// maxXIDPartSize is the maximal size of the global transaction ID and the branch qualifier.
+const maxXIDPartSize = 64
+
+// XID is a global (XA) transaction identifier.
+type XID struct {
+	FormatID int
+	// GlobalTransactionID and BranchQualifier are at most 64 bytes each.
+	GlobalTransactionID, BranchQualifier []byte
+}
+
+func (xid XID) String() string {
+	return fmt.Sprintf("%d.%x.%x", xid.FormatID, xid.GlobalTransactionID, xid.BranchQualifier)
+}
+
+// Transaction holds an OCI_Transaction: a global (XA) transaction branch,
+// or a local read-only/serializable transaction.
+type Transaction struct {
+	conn   *Connection
+	handle *C.OCI_Transaction
+	global bool
+	// detached is set by Stop on a global branch, prepared by Prepare.
+	detached, prepared bool
+}
+
+// NewTransaction creates a transaction and attaches it to the connection.
+// A nil xid creates a local transaction, otherwise a global transaction branch
+// (mode can be TxNew, TxTight or TxLoose, combined with the other modes).
+//
+// timeout is the time the stopped global transaction stays inactive, before it is rolled back.
+func (conn *Connection) NewTransaction(xid *XID, mode TxMode, timeout time.Duration) (*Transaction, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var pxid *C.OCI_XID
+	if xid != nil {
+		if len(xid.GlobalTransactionID) > maxXIDPartSize || len(xid.BranchQualifier) > maxXIDPartSize {
+			return nil, fmt.Errorf("NewTransaction(%s): the parts of the XID must be at most %d bytes", xid, maxXIDPartSize)
+		}
+		pxid = new(C.OCI_XID)
+		pxid.formatID = C.long(xid.FormatID)
+		pxid.gtrid_length = C.long(len(xid.GlobalTransactionID))
+		pxid.bqual_length = C.long(len(xid.BranchQualifier))
+		data := (*[len(pxid.data)]byte)(unsafe.Pointer(&pxid.data[0]))
+		copy(data[copy(data[:], xid.GlobalTransactionID):], xid.BranchQualifier)
+	}
+	tx := Transaction{
+		conn:   conn,
+		handle: C.OCI_TransactionCreate(conn.handle, C.uint(timeout/time.Second), C.uint(mode), pxid),
+		global: xid != nil,
+	}
+	if tx.handle == nil {
+		return nil, getLastErr()
+	}
+	if C.OCI_SetTransaction(conn.handle, tx.handle) != C.TRUE {
+		err := getLastErr()
+		C.OCI_TransactionFree(tx.handle)
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Start starts the transaction.
+func (tx *Transaction) Start() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_TransactionStart(tx.handle) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Stop detaches a global transaction branch from the connection, without ending it:
+// its work is kept, and it can be resumed later with Resume, then prepared and committed.
+// If it is not resumed in the timeout given to NewTransaction, the server rolls it back.
+//
+// A local transaction is ended: committed in auto commit mode, rolled back otherwise.
+func (tx *Transaction) Stop() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if tx.global {
+		// OCI_TransactionStop would roll back the branch before detaching it
+		con := tx.conn.handle
+		if err := transDetach(C.OCI_HandleGetContext(con), C.OCI_HandleGetError(con)); err != nil {
+			return err
+		}
+		tx.detached = true
+		return nil
+	}
+	if C.OCI_TransactionStop(tx.handle) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Resume resumes a stopped global transaction.
+func (tx *Transaction) Resume() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_TransactionResume(tx.handle) != C.TRUE {
+		return getLastErr()
+	}
+	tx.detached = false
+	return nil
+}
+
+// Prepare prepares a global transaction for commit (first phase of the two-phase commit).
+// Commit commits the prepared transaction with the second phase.
+func (tx *Transaction) Prepare() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_TransactionPrepare(tx.handle) != C.TRUE {
+		return getLastErr()
+	}
+	tx.prepared = true
+	return nil
+}
+
+// Forget makes the server forget a heuristically completed global transaction.
+func (tx *Transaction) Forget() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if C.OCI_TransactionForget(tx.handle) != C.TRUE {
+		return getLastErr()
+	}
+	return nil
+}
+
+// Commit commits the transaction: with a two-phase commit if it has been prepared,
+// with a one-phase commit otherwise.
+func (tx *Transaction) Commit() error {
+	if !tx.prepared {
+		return tx.conn.Commit()
+	}
+	start := time.Now()
+	con := tx.conn.handle
+	err := transCommitTwoPhase(C.OCI_HandleGetContext(con), C.OCI_HandleGetError(con))
+	tx.conn.trace(TraceEvent{Kind: TraceCommit, Duration: time.Since(start), Err: err})
+	if err == nil {
+		tx.prepared = false
+	}
+	return err
+}
+
+// Rollback rolls back the transaction.
+func (tx *Transaction) Rollback() error {
+	return tx.conn.Rollback()
+}
+
+// Mode returns the mode of the transaction.
+func (tx *Transaction) Mode() TxMode {
+	return TxMode(C.OCI_TransactionGetMode(tx.handle))
+}
+
+// Close frees the transaction, with OCI_TransactionFree: this rolls back
+// the work not committed on the connection (or commits it in auto commit mode),
+// so commit a global branch before closing it.
+func (tx *Transaction) Close() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if tx == nil || tx.handle == nil {
+		return nil
+	}
+	var err error
+	if C.OCI_TransactionFree(tx.handle) != C.TRUE {
+		err = fmt.Errorf("error freeing transaction %p: %v", tx.handle, getLastErr())
+	}
+	tx.handle = nil
+	return err
+}
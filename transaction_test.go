@@ -0,0 +1,64 @@
+/*
+Copyright 2014 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gocilib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGlobalTransaction(t *testing.T) {
+	cx, st := testStatement(t)
+	testObject(t, st, "CREATE TABLE tst_gocilib_xa (x NUMBER(3))", "DROP TABLE tst_gocilib_xa")
+
+	xid := XID{FormatID: 1,
+		GlobalTransactionID: []byte(fmt.Sprintf("gocilib-%d", time.Now().UnixNano())),
+		BranchQualifier:     []byte("1")}
+	tx, err := cx.NewTransaction(&xid, TxNew, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	if err = tx.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Execute("INSERT INTO tst_gocilib_xa (x) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	// the detached branch keeps its work
+	if err = tx.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Execute("INSERT INTO tst_gocilib_xa (x) VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the work is seen by the other sessions
+	if row := queryRow(t, testConnection(t), "SELECT COUNT(0) FROM tst_gocilib_xa"); row[0] != int64(2) {
+		t.Errorf("got %v rows, wanted 2", row[0])
+	}
+}